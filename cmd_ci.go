@@ -0,0 +1,29 @@
+package main
+
+import "fmt"
+
+// ExpandCi prints the pipeline configuration with includes merged and
+// extends, anchors and !reference tags expanded, using the lint cache.
+func ExpandCi(job string) error {
+	err := loadCache()
+	if err != nil {
+		return fmt.Errorf("error loading cache: %w", err)
+	}
+	defer saveCache()
+
+	ciConfigPath, data, err := readCiConfig()
+	if err != nil {
+		return err
+	}
+
+	merged, err := getContentFromIncludes(ciConfigPath, data)
+	if err != nil {
+		return fmt.Errorf("error getting content from includes: %w", err)
+	}
+	expanded, err := ExpandConfig(merged, job)
+	if err != nil {
+		return fmt.Errorf("error expanding %s: %w", ciConfigPath, err)
+	}
+	fmt.Print(expanded)
+	return nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Convert writes the variables file in the format of the target file's
+// extension, e.g. to migrate gitlab_variables.json to YAML.
+func Convert(target string) error {
+	if target == "" {
+		return errors.New("missing target file, e.g. credder convert gitlab_variables.yaml")
+	}
+	if _, err := os.Stat(target); !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%s already exists", target)
+	}
+	local := ProjectSecrets{}
+	err := local.Read(DEFAULT_FILE_NAME)
+	if err != nil {
+		return fmt.Errorf("could not load local variables file: %w", err)
+	}
+	err = local.Write(target)
+	if err != nil {
+		return fmt.Errorf("could not write %s: %w", target, err)
+	}
+	fmt.Printf("Converted %s to %s; use it with --file %s\n", DEFAULT_FILE_NAME, target, target)
+	return nil
+}
@@ -3,27 +3,12 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"os"
-	"os/exec"
-
-	"github.com/creack/pty"
 )
 
-func showDiff(a string, b string) {
-	cmd := exec.Command("bash", "-c", fmt.Sprintf("diff -U 8 --color=always <(echo '%s') <(echo '%s') && echo 'no diff'", a, b))
-	f, err := pty.Start(cmd)
-	io.Copy(os.Stderr, f)
-	exit_code := cmd.ProcessState.ExitCode()
-	if err != nil {
-		fmt.Println(exit_code)
-		fmt.Println("Error executing diff command:", err)
-		return
-	}
-
-}
-
-func Diff() {
+// Diff shows the changes push would make, as a text diff or, with output
+// set to json or markdown, as a report of the changed fields.
+func Diff(planFile string, output string) {
 	local := ProjectSecrets{}
 	remote := ProjectSecrets{}
 
@@ -33,27 +18,63 @@ func Diff() {
 		return
 	}
 	local = local.InjectFiles().InjectSecrets()
+	for _, warning := range local.ScopeWarnings() {
+		fmt.Fprintln(os.Stderr, "warning:", warning)
+	}
 
-	err = remote.FetchVariables(local.ProjectID)
+	err = remote.FetchVariables(local.Target())
 	if err != nil {
 		fmt.Println("Could not load remote variables:", err)
 		return
 	}
 
+	// Only saved plans need a key that is known again when they are applied.
+	key := NewFingerprintKey()
+	if planFile != "" {
+		key, err = LoadFingerprintKey()
+		if err != nil {
+			fmt.Println("Could not save plan:", err)
+			return
+		}
+	}
+	plan := ComputePlan(local, remote, key)
+	if planFile != "" {
+		err = plan.Write(planFile)
+		if err != nil {
+			fmt.Println("Could not save plan:", err)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Saved plan with %d change(s) to %s; apply it with `credder push --plan %s`\n", len(plan.Changes), planFile, planFile)
+	}
+
+	switch output {
+	case "json":
+		report, err := DescribeChanges(plan, local, remote).JSON()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println(report)
+		return
+	case "markdown":
+		fmt.Print(DescribeChanges(plan, local, remote).Markdown())
+		return
+	}
+
 	// marshall to json with indents
-	localJson, err := json.MarshalIndent(local, "", "  ")
+	localJson, err := json.MarshalIndent(local.Redacted(), "", "  ")
 	if err != nil {
 		fmt.Println("Error encoding JSON:", err)
 		return
 	}
-	remoteJson, err := json.MarshalIndent(remote, "", "  ")
+	remoteJson, err := json.MarshalIndent(remote.Redacted(), "", "  ")
 	if err != nil {
 		fmt.Println("Error encoding JSON:", err)
 		return
 	}
 
 	// call command line funcion diff
-	showDiff(string(remoteJson), string(localJson))
+	showDiff(os.Stdout, string(remoteJson), string(localJson))
 
 	// Calculate file diffs
 	localFileVariables := local.FileVariables()
@@ -92,7 +113,7 @@ func Diff() {
 	for key, value := range fileTuples {
 		if value.Local != value.Remote {
 			fmt.Printf("====== %s (%s) ======\n", key.Key, key.Environment)
-			showDiff(value.Remote, value.Local)
+			showValueDiff(os.Stdout, value.Remote, value.Local)
 		}
 	}
 }
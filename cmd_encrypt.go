@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Encrypt encrypts the values of a variable in the variables file, for all
+// environments or only the given one. Without a key it encrypts stdin and
+// prints the result.
+func Encrypt(key string, environment string, recipients []string) error {
+	if key == "" {
+		plaintext, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("could not read stdin: %w", err)
+		}
+		if len(recipients) == 0 {
+			local := ProjectSecrets{}
+			if local.Read(DEFAULT_FILE_NAME) == nil {
+				recipients = local.AgeRecipients
+			}
+		}
+		encrypted, err := EncryptValue(strings.TrimSuffix(string(plaintext), "\n"), recipients)
+		if err != nil {
+			return err
+		}
+		fmt.Println(encrypted)
+		return nil
+	}
+
+	local := ProjectSecrets{}
+	err := local.Read(DEFAULT_FILE_NAME)
+	if err != nil {
+		return fmt.Errorf("could not load local variables file: %w", err)
+	}
+	if len(recipients) == 0 {
+		recipients = local.AgeRecipients
+	}
+	found := false
+	for i, secret := range local.Variables {
+		if secret.Key != key || (environment != "" && secret.Environment != environment) {
+			continue
+		}
+		found = true
+		// The value of a file variable is the path of the file holding
+		// its content, which is read before references are resolved.
+		if secret.VariableType == "file" {
+			return fmt.Errorf("%s (%s) is a file variable; its value is a path and cannot be encrypted", secret.Key, secret.Environment)
+		}
+		if IsEncryptedValue(secret.Value) {
+			fmt.Println("Already encrypted:", secret.Key, secret.Environment)
+			continue
+		}
+		encrypted, err := EncryptValue(secret.Value, recipients)
+		if err != nil {
+			return err
+		}
+		local.Variables[i].Value = encrypted
+		fmt.Println("Encrypted:", secret.Key, secret.Environment)
+	}
+	if !found {
+		return fmt.Errorf("no variable %s found in %s", key, DEFAULT_FILE_NAME)
+	}
+	return local.Write(DEFAULT_FILE_NAME)
+}
+
+// Decrypt reverses Encrypt.
+func Decrypt(key string, environment string) error {
+	identities, err := loadAgeIdentities()
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		ciphertext, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("could not read stdin: %w", err)
+		}
+		plaintext, err := DecryptValue(string(ciphertext), identities)
+		if err != nil {
+			return err
+		}
+		fmt.Println(plaintext)
+		return nil
+	}
+
+	local := ProjectSecrets{}
+	err = local.Read(DEFAULT_FILE_NAME)
+	if err != nil {
+		return fmt.Errorf("could not load local variables file: %w", err)
+	}
+	found := false
+	for i, secret := range local.Variables {
+		if secret.Key != key || (environment != "" && secret.Environment != environment) {
+			continue
+		}
+		found = true
+		if !IsEncryptedValue(secret.Value) {
+			continue
+		}
+		plaintext, err := DecryptValue(secret.Value, identities)
+		if err != nil {
+			return fmt.Errorf("%s (%s): %w", secret.Key, secret.Environment, err)
+		}
+		local.Variables[i].Value = plaintext
+		fmt.Println("Decrypted:", secret.Key, secret.Environment)
+	}
+	if !found {
+		return fmt.Errorf("no variable %s found in %s", key, DEFAULT_FILE_NAME)
+	}
+	return local.Write(DEFAULT_FILE_NAME)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Export writes the variables GitLab would give the environment, with
+// secrets injected, to out (or stdout when out is empty). Like in CI, file
+// variables are written to a file in filesDir and their path is exported.
+func Export(environment string, format string, out string, filesDir string) error {
+	if environment == "" {
+		return errors.New("missing --env; pass the environment name to export, e.g. --env production")
+	}
+	if format != "dotenv" {
+		return fmt.Errorf("unsupported export format %s; use dotenv", format)
+	}
+	local := ProjectSecrets{}
+	err := local.Read(DEFAULT_FILE_NAME)
+	if err != nil {
+		return fmt.Errorf("could not load local variables file: %w", err)
+	}
+	// Only resolve the secrets of this environment.
+	local.Variables = local.ForEnvironment(environment)
+	local = local.InjectFiles().InjectSecrets()
+
+	entries := []DotenvEntry{}
+	for _, secret := range local.Variables {
+		value := secret.Value
+		if secret.VariableType == "file" {
+			value, err = exportFile(filesDir, secret)
+			if err != nil {
+				return err
+			}
+		}
+		entries = append(entries, DotenvEntry{Key: secret.Key, Value: value})
+	}
+	content := FormatDotenv(entries)
+	if out == "" {
+		fmt.Print(content)
+		return nil
+	}
+	err = os.WriteFile(out, []byte(content), 0600)
+	if err != nil {
+		return fmt.Errorf("could not write %s: %w", out, err)
+	}
+	fmt.Printf("Exported %d variable(s) for %s to %s; DO NOT COMMIT, CONTAINS SECRETS\n", len(entries), environment, out)
+	return nil
+}
+
+// exportFile writes the content of a file variable to dir and returns the
+// absolute path, so the .env file works from any directory.
+func exportFile(dir string, secret Secret) (string, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return "", fmt.Errorf("could not create directory for file variables: %w", err)
+	}
+	path, err := filepath.Abs(filepath.Join(dir, secret.Key))
+	if err != nil {
+		return "", err
+	}
+	err = os.WriteFile(path, []byte(secret.Value), 0600)
+	if err != nil {
+		return "", fmt.Errorf("could not write file variable %s: %w", secret.Key, err)
+	}
+	return path, nil
+}
@@ -2,19 +2,28 @@ package main
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"os"
 )
 
-func Import() {
+func Import(target Target) {
 	fmt.Println("Importing GitLab variables to local file, DO NOT PUSH TO REPO; CONTAINS SECRETS")
-	projectId := GetProjectID()
 	remote := ProjectSecrets{}
-	err := remote.FetchVariables(projectId)
+	err := remote.FetchVariables(target)
 	if err != nil {
 		fmt.Println("Could not load remote variables:", err)
 		return
 	}
+	remote.GitlabURL = gitlabURL
+
+	// Keep the comments of an existing file.
+	if _, err := os.Stat(DEFAULT_FILE_NAME); err == nil {
+		existing := ProjectSecrets{}
+		if existing.Read(DEFAULT_FILE_NAME) == nil {
+			remote.Comments = existing.Comments
+		}
+	}
 
 	for i, secret := range remote.Variables {
 		if secret.VariableType != "file" {
@@ -42,3 +51,64 @@ func Import() {
 		return
 	}
 }
+
+// ImportDotenv merges the entries of a .env file into the variables file,
+// scoped to the given environment. With a 1Password vault and item, the
+// values are stored in a new 1Password item and referenced from the file.
+func ImportDotenv(from string, environment string, opVault string, opItem string) error {
+	if (opVault == "") != (opItem == "") {
+		return errors.New("--op-vault and --op-item must be given together")
+	}
+	content, err := os.ReadFile(from)
+	if err != nil {
+		return fmt.Errorf("could not read %s: %w", from, err)
+	}
+	entries, err := ParseDotenv(string(content))
+	if err != nil {
+		return fmt.Errorf("could not parse %s: %w", from, err)
+	}
+
+	local := ProjectSecrets{}
+	err = local.Read(DEFAULT_FILE_NAME)
+	if err != nil {
+		return fmt.Errorf("could not load local variables file: %w", err)
+	}
+
+	if opVault != "" {
+		fields := make(map[string]string)
+		for i, entry := range entries {
+			fields[entry.Key] = entry.Value
+			entries[i].Value = fmt.Sprintf("op://%s/%s/%s", opVault, opItem, entry.Key)
+		}
+		err = CreateOnePasswordItem(opVault, opItem, fields)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Stored %d value(s) in 1Password item %s in vault %s\n", len(fields), opItem, opVault)
+	}
+
+	byKey := make(map[VariableKey]int)
+	for i, secret := range local.Variables {
+		byKey[secret.VariableKey()] = i
+	}
+	for _, entry := range entries {
+		key := VariableKey{Key: entry.Key, Environment: environment}
+		if i, found := byKey[key]; found {
+			local.Variables[i].Value = entry.Value
+			fmt.Println("Updated:", entry.Key, environment)
+			continue
+		}
+		local.Variables = append(local.Variables, Secret{
+			Key:          entry.Key,
+			Value:        entry.Value,
+			VariableType: "env_var",
+			Environment:  environment,
+			Protect:      true,
+			Raw:          true,
+		})
+		byKey[key] = len(local.Variables) - 1
+		fmt.Println("Added:", entry.Key, environment)
+	}
+	local.Order()
+	return local.Write(DEFAULT_FILE_NAME)
+}
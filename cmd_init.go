@@ -1,32 +1,37 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 )
 
-func init_variables(project_id int) {
+func init_variables(target Target) {
 	_, err := os.Stat(DEFAULT_FILE_NAME)
 	if !errors.Is(err, os.ErrNotExist) {
 		fmt.Printf("Variables file (%s) already exists, or something else went wrong: %s", DEFAULT_FILE_NAME, err)
 		return
 	}
 	var project ProjectSecrets = ProjectSecrets{
-		ProjectID: project_id,
+		ProjectID: target.ProjectID,
+		GroupID:   target.GroupID,
+		Instance:  target.Instance,
+		GitlabURL: gitlabURL,
 		Variables: []Secret{},
 	}
 
-	content, err := json.Marshal(project)
+	err = project.Write(DEFAULT_FILE_NAME)
 	if err != nil {
-		fmt.Println("Error encoding JSON:", err)
 		return
 	}
-	err = os.WriteFile(DEFAULT_FILE_NAME, content, 0644)
-	if err != nil {
-		fmt.Println("Could not write variables file:", err)
-		return
+	// The fingerprint key is per user and stays out of the repository.
+	if os.Getenv("CREDDER_FINGERPRINT_KEY") == "" && os.Getenv("CREDDER_FINGERPRINT_KEY_FILE") == "" {
+		path, err := CreateFingerprintKey()
+		if err != nil {
+			fmt.Println("Could not create fingerprint key:", err)
+		} else {
+			fmt.Println("Fingerprint key:", path)
+		}
 	}
 	Pull()
 }
@@ -13,7 +13,7 @@ func Pull() {
 	}
 	injected := local.InjectFiles().InjectSecrets()
 
-	err = remote.FetchVariables(local.ProjectID)
+	err = remote.FetchVariables(local.Target())
 	if err != nil {
 		fmt.Println("Could not load remote variables:", err)
 		return
@@ -3,123 +3,228 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 )
 
-func Push() {
+// PushOptions configures how push asks for approval. Without any approve
+// option push prompts for every change.
+type PushOptions struct {
+	// PlanFile is a plan saved with `diff --out`; its changes count as approved.
+	PlanFile      string
+	ApproveCreate bool
+	ApproveUpdate bool
+	ApproveDelete bool
+	// NoDelete skips deletes, whatever else is approved.
+	NoDelete bool
+	// SummaryFile receives a JSON summary of the push; "-" is stdout.
+	SummaryFile string
+}
+
+func (options PushOptions) Interactive() bool {
+	return options.PlanFile == "" && !options.ApproveCreate && !options.ApproveUpdate && !options.ApproveDelete
+}
+
+func (options PushOptions) approved(action string) bool {
+	if options.PlanFile != "" {
+		return true
+	}
+	switch action {
+	case ActionCreate:
+		return options.ApproveCreate
+	case ActionUpdate:
+		return options.ApproveUpdate
+	case ActionDelete:
+		return options.ApproveDelete
+	}
+	return false
+}
+
+const (
+	StatusApplied = "applied"
+	StatusSkipped = "skipped"
+	StatusFailed  = "failed"
+)
+
+type PushResult struct {
+	Action      string `json:"action"`
+	Key         string `json:"key"`
+	Environment string `json:"env"`
+	Status      string `json:"status"`
+	Error       string `json:"error,omitempty"`
+}
+
+// PushSummary is the machine-readable outcome of a push.
+type PushSummary struct {
+	Applied int          `json:"applied"`
+	Skipped int          `json:"skipped"`
+	Failed  int          `json:"failed"`
+	Changes []PushResult `json:"changes"`
+}
+
+func (summary *PushSummary) Add(change PlanChange, status string, err error) {
+	result := PushResult{
+		Action:      change.Action,
+		Key:         change.Key,
+		Environment: change.Environment,
+		Status:      status,
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	switch status {
+	case StatusApplied:
+		summary.Applied++
+	case StatusSkipped:
+		summary.Skipped++
+	case StatusFailed:
+		summary.Failed++
+	}
+	summary.Changes = append(summary.Changes, result)
+}
+
+func (summary PushSummary) Write(filename string) error {
+	content, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding summary: %w", err)
+	}
+	if filename == "-" {
+		fmt.Println(string(content))
+		return nil
+	}
+	return os.WriteFile(filename, content, 0644)
+}
+
+// showChange writes what a change does to w before asking for approval.
+func showChange(w io.Writer, change PlanChange, local Secret, remote Secret) {
+	switch change.Action {
+	case ActionCreate:
+		fmt.Fprintln(w, "Creating variable:", local.Key, local.Environment)
+		jsonVar, err := json.MarshalIndent(local.Redacted(), "", "  ")
+		if err == nil {
+			fmt.Fprintln(w, string(jsonVar))
+		} else {
+			fmt.Fprintln(w, "ERROR")
+		}
+		fmt.Fprintln(w, "CREATE? (y/n): ")
+	case ActionUpdate:
+		fmt.Fprintln(w, "Updating variable:", local.Key, local.Environment)
+		jsonLocalVar, err := json.MarshalIndent(local.Redacted(), "", "  ")
+		jsonRemoteVar, err2 := json.MarshalIndent(remote.Redacted(), "", "  ")
+		if err == nil && err2 == nil {
+			showDiff(w, string(jsonRemoteVar), string(jsonLocalVar))
+			if !showSecrets || (local.VariableType == "file" && local.Value != remote.Value) {
+				showValueDiff(w, remote.Value, local.Value)
+			}
+		} else {
+			fmt.Fprintln(w, "ERROR")
+		}
+		fmt.Fprintln(w, "Do you want to UPDATE this variable? (y/n): ")
+	case ActionDelete:
+		fmt.Fprintln(w, "Deleting variable:", remote.Key, remote.Environment)
+		jsonVar, err := json.MarshalIndent(remote.Redacted(), "", "  ")
+		if err == nil {
+			fmt.Fprintln(w, string(jsonVar))
+		} else {
+			fmt.Fprintln(w, "ERROR")
+		}
+		fmt.Fprintln(w, "Do you want to DELETE this variable? (y/n): ")
+	}
+}
+
+func Push(options PushOptions) error {
+	// With the summary on stdout, everything else goes to stderr so the
+	// summary can be parsed.
+	var out io.Writer = os.Stdout
+	if options.SummaryFile == "-" {
+		out = os.Stderr
+	}
+
 	// Read the file
 	local := ProjectSecrets{}
 	remote := ProjectSecrets{}
 	err := local.Read(DEFAULT_FILE_NAME)
 	if err != nil {
-		fmt.Println("Could not load local variables file:", err)
-		return
+		return fmt.Errorf("could not load local variables file: %w", err)
 	}
 	local = local.InjectFiles().InjectSecrets()
+	err = reportProblems(out, local.Validate())
+	if err != nil {
+		return fmt.Errorf("not pushing, fix the variables file first: %w", err)
+	}
 
 	// Get the remote variables
-	err = remote.FetchVariables(local.ProjectID)
+	err = remote.FetchVariables(local.Target())
 	if err != nil {
-		fmt.Println("Could not load remote variables:", err)
-		return
-	}
-
-	// Find variables only in local and overlapping ones
-	localOnly := []Secret{}
-	overlappingLocal := []Secret{}
-	overlappingRemote := []Secret{}
-	for _, localVar := range local.Variables {
-		found := false
-		for _, remoteVar := range remote.Variables {
-			if localVar.Key == remoteVar.Key && localVar.Environment == remoteVar.Environment {
-				overlappingLocal = append(overlappingLocal, localVar)
-				overlappingRemote = append(overlappingRemote, remoteVar)
-				found = true
-				break
-			}
-		}
-		if !found {
-			localOnly = append(localOnly, localVar)
-		}
+		return fmt.Errorf("could not load remote variables: %w", err)
 	}
 
-	// Find variables only in remote
-	remoteOnly := []Secret{}
-	for _, remoteVar := range remote.Variables {
-		found := false
-		for _, localVar := range local.Variables {
-			if localVar.Key == remoteVar.Key && localVar.Environment == remoteVar.Environment {
-				found = true
-				break
-			}
-		}
-		if !found {
-			remoteOnly = append(remoteOnly, remoteVar)
-		}
-	}
+	plan := ComputePlan(local, remote, NewFingerprintKey())
+	localByKey := variablesByKey(local.Variables)
+	remoteByKey := variablesByKey(remote.Variables)
 
-	// CREATION:
-	var input string
-	// create local only remote
-	for _, localVar := range localOnly {
-		fmt.Println("Creating variable:", localVar.Key, localVar.Environment)
-		jsonVar, err := json.MarshalIndent(localVar, "", "  ")
-		if err == nil {
-			fmt.Println(string(jsonVar))
-		} else {
-			fmt.Println("ERROR")
+	// A saved plan was reviewed already; apply it as is, or not at all.
+	if options.PlanFile != "" {
+		saved := Plan{}
+		err = saved.Read(options.PlanFile)
+		if err != nil {
+			return err
 		}
-		fmt.Println("CREATE? (y/n): ")
-		fmt.Scanln(&input)
-		if input != "y" {
-			continue
+		key, err := LoadFingerprintKey()
+		if err != nil {
+			return fmt.Errorf("cannot check %s: %w", options.PlanFile, err)
 		}
-		err = CreateVariable(local.ProjectID, localVar)
+		err = saved.CheckDrift(ComputePlan(local, remote, key))
 		if err != nil {
-			fmt.Println("Could not CREATE variable:", err)
+			return fmt.Errorf("refusing to apply %s: %w", options.PlanFile, err)
 		}
+		plan = saved
 	}
 
-	// update overlapping variables
-	for i, localVar := range overlappingLocal {
-		if localVar == overlappingRemote[i] {
+	summary := PushSummary{Changes: []PushResult{}}
+	for _, change := range plan.Changes {
+		if change.Action == ActionDelete && options.NoDelete {
+			fmt.Fprintln(out, "Not deleting variable (--no-delete):", change.Key, change.Environment)
+			summary.Add(change, StatusSkipped, nil)
 			continue
 		}
-		fmt.Println("Updating variable:", localVar.Key, localVar.Environment)
-		remoteSecret := overlappingRemote[i]
-		jsonLocalVar, err := json.MarshalIndent(localVar, "", "  ")
-		jsonRemoteVar, err2 := json.MarshalIndent(remoteSecret, "", "  ")
-		if err == nil && err2 == nil {
-			showDiff(string(jsonRemoteVar), string(jsonLocalVar))
-			if localVar.VariableType == "file" && localVar.Value != remoteSecret.Value {
-				showDiff(remoteSecret.Value, localVar.Value)
+		if options.Interactive() {
+			showChange(out, change, localByKey[change.VariableKey()], remoteByKey[change.VariableKey()])
+			// An empty or unreadable answer is a no.
+			var input string
+			fmt.Scanln(&input)
+			if input != "y" {
+				summary.Add(change, StatusSkipped, nil)
+				continue
 			}
-		} else {
-			fmt.Println("ERROR")
-		}
-		fmt.Println("Do you want to UPDATE this variable? (y/n): ")
-		fmt.Scanln(&input)
-		if input != "y" {
+		} else if !options.approved(change.Action) {
+			fmt.Fprintf(out, "Not approved, skipping %s of variable: %s %s\n", change.Action, change.Key, change.Environment)
+			summary.Add(change, StatusSkipped, nil)
 			continue
+		} else {
+			fmt.Fprintf(out, "Applying %s of variable: %s %s\n", change.Action, change.Key, change.Environment)
 		}
-		err = UpdateVariable(local.ProjectID, localVar)
+
+		err = ApplyChange(local.Target(), change, localByKey)
 		if err != nil {
-			fmt.Println("Could not update variable:", err)
+			fmt.Fprintf(out, "Could not %s variable: %s\n", change.Action, err)
+			summary.Add(change, StatusFailed, err)
+			continue
 		}
+		summary.Add(change, StatusApplied, nil)
 	}
 
-	// Delete variables
-	for _, remoteVar := range remoteOnly {
-		fmt.Println("Deleting variable:", remoteVar.Key, remoteVar.Environment)
-		fmt.Println(remoteVar)
-		fmt.Println("Do you want to DELETE this variable? (y/n): ")
-		fmt.Scanln(&input)
-		if input != "y" {
-			continue
-		}
-		err = DeleteVariable(local.ProjectID, remoteVar.Key, remoteVar.Environment)
+	if !options.Interactive() {
+		fmt.Fprintf(out, "Applied %d, skipped %d, failed %d change(s)\n", summary.Applied, summary.Skipped, summary.Failed)
+	}
+	if options.SummaryFile != "" {
+		err = summary.Write(options.SummaryFile)
 		if err != nil {
-			fmt.Println("Could not delete variable:", err)
+			return fmt.Errorf("could not write summary: %w", err)
 		}
 	}
-
+	if summary.Failed > 0 {
+		return fmt.Errorf("%d change(s) failed", summary.Failed)
+	}
+	return nil
 }
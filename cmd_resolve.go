@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ResolveEnvironment shows which variable GitLab uses for each key in an
+// environment, which definitions it overrides, and where the outcome is
+// ambiguous.
+func ResolveEnvironment(environment string) error {
+	local := ProjectSecrets{}
+	err := local.Read(DEFAULT_FILE_NAME)
+	if err != nil {
+		return fmt.Errorf("could not load local variables file: %w", err)
+	}
+
+	resolutions := local.Resolve(environment)
+	if len(resolutions) == 0 {
+		fmt.Printf("No variables apply to %q\n", environment)
+	}
+	// Only read files and resolve secrets when the values are shown.
+	values := map[string]string{}
+	if showSecrets {
+		winners := local
+		winners.Variables = local.ForEnvironment(environment)
+		for _, secret := range winners.InjectFiles().InjectSecrets().Variables {
+			values[secret.Key] = secret.Value
+		}
+	}
+	for _, resolution := range resolutions {
+		line := fmt.Sprintf("%s (%s)", resolution.Key, resolution.Winner.Environment)
+		if showSecrets {
+			line += ": " + values[resolution.Key]
+		}
+		if len(resolution.Shadowed) > 0 {
+			line += fmt.Sprintf(" [overrides %s]", scopeList(resolution.Shadowed))
+		}
+		fmt.Println(line)
+	}
+
+	warnings := []string{}
+	for _, resolution := range resolutions {
+		if len(resolution.Ambiguous) > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s: scopes %s and %s match %q with the same precedence; GitLab may use either",
+				resolution.Key, resolution.Winner.Environment, scopeList(resolution.Ambiguous), environment))
+		}
+	}
+	for _, warning := range local.ScopeWarnings() {
+		warnings = append(warnings, warning.String())
+	}
+	for _, warning := range warnings {
+		fmt.Fprintln(os.Stderr, "warning:", warning)
+	}
+	return nil
+}
+
+func scopeList(secrets []Secret) string {
+	scopes := []string{}
+	for _, secret := range secrets {
+		scopes = append(scopes, secret.Environment)
+	}
+	return strings.Join(scopes, ", ")
+}
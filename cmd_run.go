@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/urfave/cli/v3"
+)
+
+// splitRunArgs separates the --env flag of the run command from the command
+// to run, which follows it, optionally after a "--".
+func splitRunArgs(args []string) (string, []string, error) {
+	environment := ""
+	found := false
+	for len(args) > 0 {
+		arg := args[0]
+		switch {
+		case arg == "--":
+			args = args[1:]
+		case arg == "--env" || arg == "-env":
+			if len(args) < 2 {
+				return "", nil, errors.New("flag needs an argument: --env")
+			}
+			environment, found = args[1], true
+			args = args[2:]
+			continue
+		case strings.HasPrefix(arg, "--env=") || strings.HasPrefix(arg, "-env="):
+			environment, found = arg[strings.Index(arg, "=")+1:], true
+			args = args[1:]
+			continue
+		}
+		break
+	}
+	if !found {
+		return "", nil, errors.New("Required flag \"env\" not set")
+	}
+	return environment, args, nil
+}
+
+// Run executes a command with the variables GitLab would give the
+// environment. As in CI, file variables are written to temporary files and
+// the variable holds the path; the files are removed afterwards.
+func Run(environment string, args []string) error {
+	if len(args) == 0 {
+		return errors.New("missing command, e.g. credder run --env production -- ./deploy.sh")
+	}
+	local := ProjectSecrets{}
+	err := local.Read(DEFAULT_FILE_NAME)
+	if err != nil {
+		return fmt.Errorf("could not load local variables file: %w", err)
+	}
+	local.Variables = local.ForEnvironment(environment)
+	local = local.InjectFiles().InjectSecrets()
+
+	tempDir, err := os.MkdirTemp("", "credder-run-")
+	if err != nil {
+		return fmt.Errorf("could not create directory for file variables: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	env := os.Environ()
+	if environment != "" {
+		env = append(env, "CI_ENVIRONMENT_NAME="+environment)
+	}
+	for _, secret := range local.Variables {
+		value := secret.Value
+		if secret.VariableType == "file" {
+			path := filepath.Join(tempDir, secret.Key)
+			err = os.WriteFile(path, []byte(secret.Value), 0600)
+			if err != nil {
+				return fmt.Errorf("could not write file variable %s: %w", secret.Key, err)
+			}
+			value = path
+		}
+		env = append(env, secret.Key+"="+value)
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// Pass interrupts on to the command, and stay alive to clean up.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	err = cmd.Start()
+	if err != nil {
+		return fmt.Errorf("could not start %s: %w", args[0], err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	for {
+		select {
+		case sig := <-signals:
+			cmd.Process.Signal(sig)
+		case err = <-done:
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				return cli.Exit("", exitErr.ExitCode())
+			}
+			return err
+		}
+	}
+}
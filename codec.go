@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// fileCodec encodes and decodes the variables file in one format.
+type fileCodec struct {
+	Name      string
+	Marshal   func(value any) ([]byte, error)
+	Unmarshal func(filename string, content []byte, value any) error
+}
+
+var jsonCodec = fileCodec{
+	Name: "JSON",
+	Marshal: func(value any) ([]byte, error) {
+		return json.MarshalIndent(value, "", "  ")
+	},
+	Unmarshal: decodeStrictJSON,
+}
+
+var yamlCodec = fileCodec{
+	Name: "YAML",
+	Marshal: func(value any) ([]byte, error) {
+		var buffer bytes.Buffer
+		encoder := yaml.NewEncoder(&buffer)
+		encoder.SetIndent(2)
+		err := encoder.Encode(value)
+		return buffer.Bytes(), err
+	},
+	Unmarshal: func(filename string, content []byte, value any) error {
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		err := decoder.Decode(value)
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+		return nil
+	},
+}
+
+var tomlCodec = fileCodec{
+	Name: "TOML",
+	Marshal: func(value any) ([]byte, error) {
+		var buffer bytes.Buffer
+		err := toml.NewEncoder(&buffer).Encode(value)
+		return buffer.Bytes(), err
+	},
+	Unmarshal: func(filename string, content []byte, value any) error {
+		metadata, err := toml.Decode(string(content), value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+		if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+			keys := []string{}
+			seen := make(map[string]bool)
+			for _, key := range undecoded {
+				if !seen[key.String()] {
+					keys = append(keys, key.String())
+				}
+				seen[key.String()] = true
+			}
+			sort.Strings(keys)
+			return fmt.Errorf("%s: unknown field(s) %s", filename, strings.Join(keys, ", "))
+		}
+		return nil
+	},
+}
+
+// codecForFile picks the codec by file extension; JSON is the default.
+func codecForFile(filename string) fileCodec {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".jsonc":
+		return jsoncCodec
+	case ".yaml", ".yml":
+		return yamlCodec
+	case ".toml":
+		return tomlCodec
+	}
+	return jsonCodec
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// DecodeError is a decoding error with the position it occurred at.
+type DecodeError struct {
+	Filename string
+	Line     int
+	Column   int
+	Err      error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.Filename, e.Line, e.Column, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// position converts a byte offset to a 1-based line and column.
+func position(content []byte, offset int64) (int, int) {
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
+	}
+	before := content[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+// keyOffset returns the offset of the first object key with the given name,
+// or -1 when there is none.
+func keyOffset(content []byte, name string) int64 {
+	type frame struct {
+		object  bool
+		wantKey bool
+	}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	stack := []frame{}
+	for {
+		start := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err != nil {
+			return -1
+		}
+		delim, isDelim := token.(json.Delim)
+		if isDelim && (delim == '}' || delim == ']') {
+			stack = stack[:len(stack)-1]
+			if len(stack) > 0 && stack[len(stack)-1].object {
+				stack[len(stack)-1].wantKey = true
+			}
+			continue
+		}
+		if len(stack) > 0 && stack[len(stack)-1].wantKey {
+			if token == name {
+				return start + int64(bytes.Index(content[start:], []byte(strconv.Quote(name))))
+			}
+			stack[len(stack)-1].wantKey = false
+			continue
+		}
+		if isDelim {
+			stack = append(stack, frame{object: delim == '{', wantKey: delim == '{'})
+			continue
+		}
+		if len(stack) > 0 && stack[len(stack)-1].object {
+			stack[len(stack)-1].wantKey = true
+		}
+	}
+}
+
+// valueOffset returns the offset of the value that ends at end, or end when
+// there is none. Type errors give the offset after the offending value.
+func valueOffset(content []byte, end int64) int64 {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	starts := []int64{}
+	for {
+		start := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err != nil {
+			return end
+		}
+		// Skip the separators before the token.
+		for start < int64(len(content)) && strings.ContainsRune(" \t\r\n,:", rune(content[start])) {
+			start++
+		}
+		delim, isDelim := token.(json.Delim)
+		switch {
+		case isDelim && (delim == '{' || delim == '['):
+			starts = append(starts, start)
+		case isDelim:
+			start = starts[len(starts)-1]
+			starts = starts[:len(starts)-1]
+			fallthrough
+		default:
+			if decoder.InputOffset() == end {
+				return start
+			}
+		}
+	}
+}
+
+// decodeStrictJSON decodes content into value, rejecting unknown fields, and
+// reports the position of any problem.
+func decodeStrictJSON(filename string, content []byte, value any) error {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(value)
+	if err == nil {
+		end := decoder.InputOffset()
+		if _, err := decoder.Token(); err != io.EOF {
+			trailing := bytes.TrimLeft(content[end:], " \t\r\n")
+			line, column := position(content, int64(len(content)-len(trailing)))
+			return &DecodeError{Filename: filename, Line: line, Column: column, Err: errors.New("unexpected content after the document")}
+		}
+		return nil
+	}
+
+	offset := decoder.InputOffset()
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) {
+		// The offending character is the last one read.
+		offset = max(syntaxErr.Offset-1, 0)
+	} else if errors.As(err, &typeErr) {
+		offset = valueOffset(content, typeErr.Offset)
+	} else if field, found := strings.CutPrefix(err.Error(), "json: unknown field "); found {
+		if name, unquoteErr := strconv.Unquote(field); unquoteErr == nil {
+			if keyAt := keyOffset(content, name); keyAt >= 0 {
+				offset = keyAt
+			}
+			err = fmt.Errorf("unknown field %q", name)
+		}
+	}
+	line, column := position(content, offset)
+	return &DecodeError{Filename: filename, Line: line, Column: column, Err: err}
+}
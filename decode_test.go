@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDecodeStrictJSON(t *testing.T) {
+	// Positions are 1-based lines and columns; type errors point at the value.
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"{\n  \"variables\": [],\n  \"extra\": 1\n}", `vars.json:3:3: unknown field "extra"`},
+		{"{\n  \"variables\": [\n    {\"key\": \"A\", \"secret\": true}\n  ]\n}", `vars.json:3:18: unknown field "secret"`},
+		// A field of the same name elsewhere does not move the position.
+		{"{\n  \"variables\": [\n    {\"key\": \"instance\"},\n    {\"instance\": true}\n  ]\n}", `vars.json:4:6: unknown field "instance"`},
+		{"{\n  \"project_id\": \"12\",\n  \"variables\": []\n}", `vars.json:2:17: json: cannot unmarshal string`},
+		{"{\n  \"variables\": [\n    {\"key\": \"A\", \"protect\": \"yes\"}\n  ]\n}", `vars.json:3:29: json: cannot unmarshal string`},
+		{"{\n  \"variables\": [,]\n}", `vars.json:2:17: invalid character ',' looking for beginning of value`},
+		{"{\"variables\": []}\n{}", `vars.json:2:1: unexpected content after the document`},
+	}
+	for _, test := range tests {
+		err := decodeStrictJSON("vars.json", []byte(test.content), &NestedProjectSecrets{})
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) || !strings.HasPrefix(err.Error(), test.want) {
+			t.Fatalf("decodeStrictJSON(%q) = %v, want %s", test.content, err, test.want)
+		}
+	}
+
+	project := NestedProjectSecrets{}
+	err := decodeStrictJSON("vars.json", []byte(`{"project_id": 12, "variables": [{"key": "A"}]}`), &project)
+	if err != nil || project.ProjectID != 12 || project.Variables[0].Key != "A" {
+		t.Fatalf("decodeStrictJSON() = %v, %v, want project 12 with A", err, project)
+	}
+}
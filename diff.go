@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// DiffOptions configures how diffs are rendered.
+type DiffOptions struct {
+	// Context is the number of unchanged lines around each change.
+	Context int
+	Color   bool
+}
+
+var diffOptions = DiffOptions{Context: 8}
+
+const (
+	colorReset = "\033[0m"
+	colorBold  = "\033[1m"
+	colorRed   = "\033[31m"
+	colorGreen = "\033[32m"
+	colorCyan  = "\033[36m"
+)
+
+// ColorEnabled resolves a --color setting (auto, always or never); auto
+// colours only when stdout is a terminal and NO_COLOR is not set.
+func ColorEnabled(setting string) (bool, error) {
+	switch setting {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto", "":
+		if os.Getenv("NO_COLOR") != "" {
+			return false, nil
+		}
+		info, err := os.Stdout.Stat()
+		if err != nil {
+			return false, nil
+		}
+		return info.Mode()&os.ModeCharDevice != 0, nil
+	}
+	return false, fmt.Errorf("invalid color setting %s; use auto, always or never", setting)
+}
+
+type diffOp struct {
+	Kind byte // ' ', '-' or '+'
+	Line string
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// maxDiffEdits bounds the edits diffLines looks for; its trace grows with
+// the square of the number of edits.
+const maxDiffEdits = 1000
+
+// diffLines computes a shortest edit script from a to b with Myers'
+// algorithm, or reports false when it needs more than maxDiffEdits edits.
+func diffLines(a []string, b []string) ([]diffOp, bool) {
+	// Common lines at the start and end need no search.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	ops := []diffOp{}
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{Kind: ' ', Line: line})
+	}
+	middle, ok := diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])
+	if !ok {
+		return nil, false
+	}
+	ops = append(ops, middle...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{Kind: ' ', Line: line})
+	}
+	return ops, true
+}
+
+func diffMiddle(a []string, b []string) ([]diffOp, bool) {
+	n, m := len(a), len(b)
+	max := n + m
+	if max > maxDiffEdits {
+		max = maxDiffEdits
+	}
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	// trace[d] holds v[-d..d] before step d; that is all the walk back reads.
+	trace := [][]int{}
+
+	found := n == 0 && m == 0
+	for d := 0; d <= max && !found; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		return nil, false
+	}
+
+	// Walk the trace back from the end to recover the edits.
+	ops := []diffOp{}
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[d+k-1] < v[d+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := 0
+		if d > 0 {
+			prevX = v[d+prevK]
+		}
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, diffOp{Kind: ' ', Line: a[x]})
+		}
+		if d > 0 {
+			if x == prevX {
+				y--
+				ops = append(ops, diffOp{Kind: '+', Line: b[y]})
+			} else {
+				x--
+				ops = append(ops, diffOp{Kind: '-', Line: a[x]})
+			}
+		}
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops, true
+}
+
+// UnifiedDiff renders the difference between a and b in unified format, or
+// an empty string when they are equal.
+func UnifiedDiff(a string, b string, labelA string, labelB string, options DiffOptions) string {
+	linesA, linesB := splitLines(a), splitLines(b)
+	ops, ok := diffLines(linesA, linesB)
+
+	paint := func(color string, text string) string {
+		if !options.Color {
+			return text
+		}
+		return color + text + colorReset
+	}
+
+	var out strings.Builder
+	if !ok {
+		out.WriteString(paint(colorBold, "--- "+labelA) + "\n")
+		out.WriteString(paint(colorBold, "+++ "+labelB) + "\n")
+		out.WriteString(fmt.Sprintf("changed (%d lines -> %d lines, too many differences to show)\n", len(linesA), len(linesB)))
+		return out.String()
+	}
+
+	changed := []int{}
+	for i, op := range ops {
+		if op.Kind != ' ' {
+			changed = append(changed, i)
+		}
+	}
+	if len(changed) == 0 {
+		return ""
+	}
+
+	out.WriteString(paint(colorBold, "--- "+labelA) + "\n")
+	out.WriteString(paint(colorBold, "+++ "+labelB) + "\n")
+
+	// Line numbers in a and b before each op.
+	lineA := make([]int, len(ops)+1)
+	lineB := make([]int, len(ops)+1)
+	for i, op := range ops {
+		lineA[i+1], lineB[i+1] = lineA[i], lineB[i]
+		if op.Kind != '+' {
+			lineA[i+1]++
+		}
+		if op.Kind != '-' {
+			lineB[i+1]++
+		}
+	}
+
+	context := options.Context
+	if context < 0 {
+		context = 0
+	}
+	for i := 0; i < len(changed); {
+		start := changed[i] - context
+		if start < 0 {
+			start = 0
+		}
+		// Merge changes whose context overlaps into one hunk.
+		j := i
+		for j+1 < len(changed) && changed[j+1]-changed[j] <= 2*context+1 {
+			j++
+		}
+		end := changed[j] + context + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		countA := lineA[end] - lineA[start]
+		countB := lineB[end] - lineB[start]
+		firstA, firstB := lineA[start]+1, lineB[start]+1
+		if countA == 0 {
+			firstA--
+		}
+		if countB == 0 {
+			firstB--
+		}
+		out.WriteString(paint(colorCyan, fmt.Sprintf("@@ -%d,%d +%d,%d @@", firstA, countA, firstB, countB)) + "\n")
+		for _, op := range ops[start:end] {
+			line := string(op.Kind) + op.Line
+			switch op.Kind {
+			case '-':
+				line = paint(colorRed, line)
+			case '+':
+				line = paint(colorGreen, line)
+			}
+			out.WriteString(line + "\n")
+		}
+		i = j + 1
+	}
+	return out.String()
+}
+
+// writeDiff writes the diff from a (remote) to b (local), or "no diff".
+func writeDiff(w io.Writer, a string, b string, options DiffOptions) {
+	diff := UnifiedDiff(a, b, "remote", "local", options)
+	if diff == "" {
+		fmt.Fprintln(w, "no diff")
+		return
+	}
+	fmt.Fprint(w, diff)
+}
+
+func showDiff(w io.Writer, a string, b string) {
+	writeDiff(w, a, b, diffOptions)
+}
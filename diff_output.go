@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// FieldChange is the old and new value of one field of a variable. Old is
+// nil for creates and New is nil for deletes.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   any    `json:"old,omitempty"`
+	New   any    `json:"new,omitempty"`
+}
+
+type VariableChange struct {
+	Action      string        `json:"action"`
+	Key         string        `json:"key"`
+	Environment string        `json:"env"`
+	Fields      []FieldChange `json:"fields"`
+}
+
+type ChangeReport struct {
+	Target  string           `json:"target"`
+	Create  int              `json:"create"`
+	Update  int              `json:"update"`
+	Delete  int              `json:"delete"`
+	Changes []VariableChange `json:"changes"`
+}
+
+func secretFields(secret Secret) []FieldChange {
+	secret = secret.Redacted()
+	return []FieldChange{
+		{Field: "value", New: secret.Value},
+		{Field: "description", New: secret.Description},
+		{Field: "type", New: secret.VariableType},
+		{Field: "protect", New: secret.Protect},
+		{Field: "mask", New: secret.Mask},
+		{Field: "raw", New: secret.Raw},
+	}
+}
+
+// DescribeChanges lists the changes of a plan field by field; updates only
+// list the fields that change. Values are redacted unless secrets are shown.
+func DescribeChanges(plan Plan, local ProjectSecrets, remote ProjectSecrets) ChangeReport {
+	localByKey := variablesByKey(local.Variables)
+	remoteByKey := variablesByKey(remote.Variables)
+	report := ChangeReport{
+		Target:  plan.Target().String(),
+		Changes: []VariableChange{},
+	}
+	for _, change := range plan.Changes {
+		described := VariableChange{
+			Action:      change.Action,
+			Key:         change.Key,
+			Environment: change.Environment,
+			Fields:      []FieldChange{},
+		}
+		switch change.Action {
+		case ActionCreate:
+			report.Create++
+			described.Fields = secretFields(localByKey[change.VariableKey()])
+		case ActionDelete:
+			report.Delete++
+			for _, field := range secretFields(remoteByKey[change.VariableKey()]) {
+				described.Fields = append(described.Fields, FieldChange{Field: field.Field, Old: field.New})
+			}
+		case ActionUpdate:
+			report.Update++
+			oldFields := secretFields(remoteByKey[change.VariableKey()])
+			newFields := secretFields(localByKey[change.VariableKey()])
+			for i := range newFields {
+				if oldFields[i].New != newFields[i].New {
+					described.Fields = append(described.Fields, FieldChange{
+						Field: newFields[i].Field,
+						Old:   oldFields[i].New,
+						New:   newFields[i].New,
+					})
+				}
+			}
+		}
+		report.Changes = append(report.Changes, described)
+	}
+	return report
+}
+
+func (report ChangeReport) JSON() (string, error) {
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error encoding JSON: %w", err)
+	}
+	return string(content), nil
+}
+
+func markdownCell(value any) string {
+	if value == nil {
+		return ""
+	}
+	text := fmt.Sprint(value)
+	text = strings.ReplaceAll(text, "|", "\\|")
+	text = strings.ReplaceAll(text, "\n", "<br>")
+	text = strings.ReplaceAll(text, "`", "'")
+	return "`" + text + "`"
+}
+
+// Markdown renders the report as a table, e.g. for a merge request comment.
+func (report ChangeReport) Markdown() string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "### Variable changes for %s\n\n", report.Target)
+	if len(report.Changes) == 0 {
+		out.WriteString("No changes.\n")
+		return out.String()
+	}
+	fmt.Fprintf(&out, "**%d to create, %d to update, %d to delete**\n\n", report.Create, report.Update, report.Delete)
+	out.WriteString("| Action | Key | Environment | Field | Old | New |\n")
+	out.WriteString("| --- | --- | --- | --- | --- | --- |\n")
+	for _, change := range report.Changes {
+		for i, field := range change.Fields {
+			action, key, environment := "", "", ""
+			if i == 0 {
+				action, key, environment = change.Action, markdownCell(change.Key), markdownCell(change.Environment)
+			}
+			fmt.Fprintf(&out, "| %s | %s | %s | %s | %s | %s |\n", action, key, environment, field.Field, markdownCell(field.Old), markdownCell(field.New))
+		}
+	}
+	return out.String()
+}
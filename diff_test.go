@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	remote := "a\nb\nc\nd\ne\nf\ng\nh\n"
+	local := "a\nB\nc\nd\ne\nf\ng\nh\ni\n"
+
+	result := UnifiedDiff(remote, local, "remote", "local", DiffOptions{Context: 1})
+	want := `--- remote
++++ local
+@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+@@ -8,1 +8,2 @@
+ h
++i
+`
+	if result != want {
+		t.Fatalf("UnifiedDiff() = %q, want %q", result, want)
+	}
+
+	// Hunks closer than twice the context are merged.
+	result = UnifiedDiff(remote, local, "remote", "local", DiffOptions{Context: 3})
+	want = `--- remote
++++ local
+@@ -1,8 +1,9 @@
+ a
+-b
++B
+ c
+ d
+ e
+ f
+ g
+ h
++i
+`
+	if result != want {
+		t.Fatalf("UnifiedDiff() = %q, want %q", result, want)
+	}
+
+	if result := UnifiedDiff(remote, remote, "remote", "local", DiffOptions{Context: 3}); result != "" {
+		t.Fatalf("UnifiedDiff() of equal input = %q, want empty", result)
+	}
+	result = UnifiedDiff("", "x\n", "remote", "local", DiffOptions{})
+	want = "--- remote\n+++ local\n@@ -0,0 +1,1 @@\n+x\n"
+	if result != want {
+		t.Fatalf("UnifiedDiff() from empty = %q, want %q", result, want)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct{ a, b string }{
+		{"", ""},
+		{"a\nb\nc\n", "a\nb\nc\n"},
+		{"a\nb\nc\n", ""},
+		{"", "a\nb\n"},
+		{"a\nb\nc\nd\n", "a\nx\nc\ny\nd\n"},
+		{"x\ny\nz\n", "z\ny\nx\n"},
+		{"a\na\nb\na\n", "b\na\na\na\nb\n"},
+	}
+	for _, test := range tests {
+		a, b := splitLines(test.a), splitLines(test.b)
+		ops, ok := diffLines(a, b)
+		if !ok {
+			t.Fatalf(`diffLines(%q, %q) gave up`, test.a, test.b)
+		}
+		gotA, gotB := []string{}, []string{}
+		for _, op := range ops {
+			if op.Kind != '+' {
+				gotA = append(gotA, op.Line)
+			}
+			if op.Kind != '-' {
+				gotB = append(gotB, op.Line)
+			}
+		}
+		if strings.Join(gotA, "\n") != strings.Join(a, "\n") || strings.Join(gotB, "\n") != strings.Join(b, "\n") {
+			t.Fatalf(`diffLines(%q, %q) = %v, which does not turn one into the other`, test.a, test.b, ops)
+		}
+	}
+
+	var remote, local strings.Builder
+	for i := 0; i < maxDiffEdits; i++ {
+		fmt.Fprintf(&remote, "remote %d\n", i)
+		fmt.Fprintf(&local, "local %d\n", i)
+	}
+	result := UnifiedDiff(remote.String(), local.String(), "remote", "local", DiffOptions{})
+	want := "--- remote\n+++ local\nchanged (1000 lines -> 1000 lines, too many differences to show)\n"
+	if result != want {
+		t.Fatalf("UnifiedDiff() of very different input = %q, want %q", result, want)
+	}
+}
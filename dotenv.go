@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DotenvEntry is a single KEY=VALUE line of a .env file.
+type DotenvEntry struct {
+	Key   string
+	Value string
+}
+
+var dotenvKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// ParseDotenv reads .env content as understood by docker compose: optional
+// `export`, # comments, single quoted literals, and double quoted values
+// with \n, \", \\ and \$ escapes that may span lines.
+func ParseDotenv(content string) ([]DotenvEntry, error) {
+	entries := []DotenvEntry{}
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || !dotenvKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineNumber)
+		}
+		value = strings.TrimSpace(value)
+
+		switch {
+		case strings.HasPrefix(value, "'"):
+			end := strings.Index(value[1:], "'")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated single quote", lineNumber)
+			}
+			value = value[1 : end+1]
+		case strings.HasPrefix(value, `"`):
+			raw := value[1:]
+			// Continue on the next lines until the closing quote.
+			for !hasClosingQuote(raw) {
+				if !scanner.Scan() {
+					return nil, fmt.Errorf("line %d: unterminated double quote", lineNumber)
+				}
+				lineNumber++
+				raw += "\n" + scanner.Text()
+			}
+			value = unescapeDotenv(raw[:closingQuote(raw)])
+		default:
+			if comment := strings.Index(value, " #"); comment >= 0 {
+				value = strings.TrimSpace(value[:comment])
+			}
+		}
+		entries = append(entries, DotenvEntry{Key: key, Value: value})
+	}
+	return entries, scanner.Err()
+}
+
+// closingQuote returns the index of the first unescaped double quote, or -1.
+func closingQuote(raw string) int {
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '\\' {
+			i++
+			continue
+		}
+		if raw[i] == '"' {
+			return i
+		}
+	}
+	return -1
+}
+
+func hasClosingQuote(raw string) bool {
+	return closingQuote(raw) >= 0
+}
+
+func unescapeDotenv(raw string) string {
+	var out strings.Builder
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '\\' || i+1 == len(raw) {
+			out.WriteByte(raw[i])
+			continue
+		}
+		i++
+		switch raw[i] {
+		case 'n':
+			out.WriteByte('\n')
+		case 't':
+			out.WriteByte('\t')
+		case '"', '\\', '$':
+			out.WriteByte(raw[i])
+		default:
+			out.WriteByte('\\')
+			out.WriteByte(raw[i])
+		}
+	}
+	return out.String()
+}
+
+var plainDotenvValue = regexp.MustCompile(`^[A-Za-z0-9_./:@+,=-]*$`)
+
+// quoteDotenv quotes a value so ParseDotenv (and docker compose) read it back
+// unchanged.
+func quoteDotenv(value string) string {
+	if plainDotenvValue.MatchString(value) {
+		return value
+	}
+	if !strings.ContainsAny(value, "'\n") {
+		return "'" + value + "'"
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "$", `\$`)
+	return `"` + replacer.Replace(value) + `"`
+}
+
+// FormatDotenv renders entries as a .env file.
+func FormatDotenv(entries []DotenvEntry) string {
+	var out strings.Builder
+	for _, entry := range entries {
+		fmt.Fprintf(&out, "%s=%s\n", entry.Key, quoteDotenv(entry.Value))
+	}
+	return out.String()
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDotenv(t *testing.T) {
+	content := `# database
+export DB_HOST=db.internal # primary
+DB_PASSWORD='p@ss word$'
+EMPTY=
+CERT="-----BEGIN-----
+abc\"def\\
+-----END-----"
+`
+	entries, err := ParseDotenv(content)
+	if err != nil {
+		t.Fatalf(`ParseDotenv() returned error: %v`, err)
+	}
+	want := []DotenvEntry{
+		{Key: "DB_HOST", Value: "db.internal"},
+		{Key: "DB_PASSWORD", Value: "p@ss word$"},
+		{Key: "EMPTY", Value: ""},
+		{Key: "CERT", Value: "-----BEGIN-----\nabc\"def\\\n-----END-----"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf(`ParseDotenv() = %+v, want %+v`, entries, want)
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Fatalf(`ParseDotenv() entry %d = %+v, want %+v`, i, entries[i], want[i])
+		}
+	}
+
+	// Formatting and parsing again gives the same entries.
+	again, err := ParseDotenv(FormatDotenv(entries))
+	if err != nil {
+		t.Fatalf(`ParseDotenv(FormatDotenv()) returned error: %v`, err)
+	}
+	for i := range entries {
+		if again[i] != entries[i] {
+			t.Fatalf(`round trip entry %d = %+v, want %+v`, i, again[i], entries[i])
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// GitLab's stages when a configuration does not list its own.
+var DEFAULT_STAGES = []string{"build", "test", "deploy"}
+
+// pipelineStages returns the stages of a merged configuration in order,
+// including .pre and .post.
+func pipelineStages(content string) []string {
+	stages := append([]string{}, DEFAULT_STAGES...)
+	root, err := parseConfigNode(content, "the merged configuration")
+	if err == nil {
+		if node := mappingValue(root.Content, "stages"); node != nil && node.Kind == yaml.SequenceNode {
+			stages = []string{}
+			for _, stage := range node.Content {
+				stages = append(stages, stage.Value)
+			}
+		}
+	}
+	return append(append([]string{".pre"}, stages...), ".post")
+}
+
+// jobsByStage groups jobs by stage, in the order of stages; jobs of stages
+// that are not listed come last.
+func jobsByStage(jobs []DryRunJob, stages []string) ([]string, map[string][]DryRunJob) {
+	byStage := make(map[string][]DryRunJob)
+	for _, job := range jobs {
+		byStage[job.Stage] = append(byStage[job.Stage], job)
+	}
+	order := []string{}
+	listed := make(map[string]bool)
+	for _, stage := range stages {
+		listed[stage] = true
+		if len(byStage[stage]) > 0 {
+			order = append(order, stage)
+		}
+	}
+	for _, job := range jobs {
+		if !listed[job.Stage] {
+			listed[job.Stage] = true
+			order = append(order, job.Stage)
+		}
+	}
+	return order, byStage
+}
+
+// jobNotes describes how a job runs when that is not plainly on success.
+func jobNotes(job DryRunJob) string {
+	notes := []string{}
+	if job.When != "" && job.When != "on_success" {
+		notes = append(notes, job.When)
+	}
+	if job.AllowFailure {
+		notes = append(notes, "allowed to fail")
+	}
+	return strings.Join(notes, ", ")
+}
+
+func describeDryRunJob(job DryRunJob) string {
+	if notes := jobNotes(job); notes != "" {
+		return fmt.Sprintf("%s (%s)", job.Name, notes)
+	}
+	return job.Name
+}
+
+func refName(ref string) string {
+	if ref == "" {
+		return "default branch"
+	}
+	return ref
+}
+
+// printDryRunErrors prints why a simulated pipeline would not be created,
+// and reports whether there were errors.
+func printDryRunErrors(ref string, result DryRunResult) bool {
+	if result.Valid {
+		return false
+	}
+	fmt.Printf("Errors for %s: \n", refName(ref))
+	for _, e := range result.Errors {
+		fmt.Println("=>", e)
+	}
+	return true
+}
+
+func printDryRun(ref string, result DryRunResult, stages []string) {
+	fmt.Printf("=============== Dry run for %s =================\n", refName(ref))
+	if printDryRunErrors(ref, result) {
+		return
+	}
+	order, byStage := jobsByStage(result.Jobs, stages)
+	if len(order) == 0 {
+		fmt.Println("No jobs would run")
+	}
+	for _, stage := range order {
+		fmt.Printf("%s:\n", stage)
+		for _, job := range byStage[stage] {
+			fmt.Println("  -", describeDryRunJob(job))
+		}
+	}
+}
+
+// printDryRunComparison shows per job which of the refs would run it.
+func printDryRunComparison(refs []string, results []DryRunResult, stages []string) {
+	names := []string{}
+	for _, ref := range refs {
+		names = append(names, refName(ref))
+	}
+	fmt.Printf("=============== Dry run for %s =================\n", strings.Join(names, " vs "))
+	failed := false
+	for i, ref := range refs {
+		failed = printDryRunErrors(ref, results[i]) || failed
+	}
+	if failed {
+		return
+	}
+
+	// All jobs of all refs, grouped by stage
+	all := []DryRunJob{}
+	seen := make(map[string]bool)
+	runs := make([]map[string]DryRunJob, len(refs))
+	for i, result := range results {
+		runs[i] = make(map[string]DryRunJob)
+		for _, job := range result.Jobs {
+			runs[i][job.Name] = job
+			if !seen[job.Name] {
+				seen[job.Name] = true
+				all = append(all, job)
+			}
+		}
+	}
+	order, byStage := jobsByStage(all, stages)
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(writer, "STAGE\tJOB\t%s\n", strings.Join(names, "\t"))
+	for _, stage := range order {
+		for _, job := range byStage[stage] {
+			columns := []string{}
+			for i := range refs {
+				if run, found := runs[i][job.Name]; found && jobNotes(run) != "" {
+					columns = append(columns, fmt.Sprintf("yes (%s)", jobNotes(run)))
+				} else if found {
+					columns = append(columns, "yes")
+				} else {
+					columns = append(columns, "-")
+				}
+			}
+			fmt.Fprintf(writer, "%s\t%s\t%s\n", stage, job.Name, strings.Join(columns, "\t"))
+		}
+	}
+	writer.Flush()
+}
+
+// mergeForRef merges the configuration with the includes whose rules match
+// a pipeline for ref; an empty ref is the default branch.
+func mergeForRef(projectId int, path string, content string, ref string) (string, error) {
+	name := ref
+	if name == "" {
+		branch, err := GetDefaultBranch(projectId)
+		if err != nil {
+			return "", err
+		}
+		name = branch
+	}
+	tag, err := IsTag(projectId, name)
+	if err != nil {
+		return "", fmt.Errorf("error looking up %s: %w", name, err)
+	}
+	variables := checkoutVariables(content)
+	SetRefVariables(variables, name, tag)
+	return mergeWithVariables(IncludeSource{Kind: "local", Path: path}, content, variables)
+}
+
+// DryRun simulates the pipeline of the configuration at path for each ref,
+// or for the default branch, and prints its jobs per stage. Two refs are
+// compared side by side. Includes are resolved per ref, so their rules see
+// the ref's branch or tag.
+func DryRun(path string, content string, refs []string) error {
+	projectId, err := GetProjectID()
+	if err != nil {
+		return err
+	}
+	if len(refs) == 0 {
+		refs = []string{""}
+	}
+
+	results := []DryRunResult{}
+	merged := []string{}
+	for _, ref := range refs {
+		refContent, err := mergeForRef(projectId, path, content, ref)
+		if err != nil {
+			return fmt.Errorf("error getting content from includes for %s: %w", refName(ref), err)
+		}
+		result, err := DryRunCi(projectId, refContent, ref)
+		if err != nil {
+			return fmt.Errorf("error simulating a pipeline for %s: %w", refName(ref), err)
+		}
+		results = append(results, result)
+		merged = append(merged, refContent)
+	}
+
+	stages := pipelineStages(merged[0])
+	if len(refs) == 1 {
+		printDryRun(refs[0], results[0], stages)
+		return nil
+	}
+	printDryRunComparison(refs, results, stages)
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestJobsByStage(t *testing.T) {
+	stages := pipelineStages("stages: [build, review, deploy]\nbuild: {script: [make]}\n")
+	want := []string{".pre", "build", "review", "deploy", ".post"}
+	if !reflect.DeepEqual(stages, want) {
+		t.Fatalf(`pipelineStages() = %v, want %v`, stages, want)
+	}
+	if got := pipelineStages("build: {script: [make]}\n"); len(got) != 5 || got[2] != "test" {
+		t.Errorf(`pipelineStages() without stages = %v, want the default stages`, got)
+	}
+
+	jobs := []DryRunJob{
+		{Name: "deploy", Stage: "deploy", When: "manual"},
+		{Name: "custom", Stage: "unlisted"},
+		{Name: "compile", Stage: "build"},
+		{Name: "lint", Stage: "build", AllowFailure: true},
+	}
+	order, byStage := jobsByStage(jobs, stages)
+	if !reflect.DeepEqual(order, []string{"build", "deploy", "unlisted"}) {
+		t.Errorf(`jobsByStage() order = %v`, order)
+	}
+	if len(byStage["build"]) != 2 || describeDryRunJob(byStage["build"][1]) != "lint (allowed to fail)" {
+		t.Errorf(`jobsByStage()["build"] = %v`, byStage["build"])
+	}
+	if got := describeDryRunJob(jobs[0]); got != "deploy (manual)" {
+		t.Errorf(`describeDryRunJob() = %q, want "deploy (manual)"`, got)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Expansion of a merged configuration into the pipeline GitLab evaluates:
+// jobs are merged with the jobs they extend, then !reference tags are
+// replaced by what they point at in the extended jobs. Anchors are already
+// expanded by the merge.
+
+// GitLab's limits on nesting extends and !reference.
+var MAX_EXTENDS_DEPTH = 11
+var MAX_REFERENCE_DEPTH = 10
+
+// resolveReferences returns a copy of node with its !reference tags
+// replaced. A reference in a list to a list is spliced into it, as GitLab
+// flattens script and rules.
+func resolveReferences(root *yaml.Node, node *yaml.Node, depth int) (*yaml.Node, error) {
+	if node.Tag == "!reference" {
+		if depth >= MAX_REFERENCE_DEPTH {
+			return nil, fmt.Errorf("!reference is nested deeper than %d levels", MAX_REFERENCE_DEPTH)
+		}
+		target, err := referenceTarget(root, node)
+		if err != nil {
+			return nil, err
+		}
+		return resolveReferences(root, target, depth+1)
+	}
+
+	resolved := *node
+	resolved.Content = nil
+	for _, child := range node.Content {
+		value, err := resolveReferences(root, child, depth)
+		if err != nil {
+			return nil, err
+		}
+		if node.Kind == yaml.SequenceNode && child.Tag == "!reference" && value.Kind == yaml.SequenceNode {
+			resolved.Content = append(resolved.Content, value.Content...)
+		} else {
+			resolved.Content = append(resolved.Content, value)
+		}
+	}
+	return &resolved, nil
+}
+
+// referenceTarget looks up the path of a !reference [job, key, ...].
+func referenceTarget(root *yaml.Node, reference *yaml.Node) (*yaml.Node, error) {
+	path := []string{}
+	for _, part := range reference.Content {
+		path = append(path, part.Value)
+	}
+	if reference.Kind != yaml.SequenceNode || len(path) == 0 {
+		return nil, fmt.Errorf("!reference must be a list like [job, key]")
+	}
+	target := root
+	for _, part := range path {
+		if target.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("!reference [%s]: %s is not in a hash", strings.Join(path, ", "), part)
+		}
+		target = mappingValue(target.Content, part)
+		if target == nil {
+			return nil, fmt.Errorf("!reference [%s] does not exist", strings.Join(path, ", "))
+		}
+	}
+	return target, nil
+}
+
+// extendNode merges a job with the jobs it extends, in order, recursively.
+func extendNode(root *yaml.Node, name string, chain []string) (*yaml.Node, error) {
+	for _, parent := range chain {
+		if parent == name {
+			return nil, fmt.Errorf("circular extends: %s -> %s", strings.Join(chain, " -> "), name)
+		}
+	}
+	chain = append(chain, name)
+	if len(chain) > MAX_EXTENDS_DEPTH {
+		return nil, fmt.Errorf("extends of %s is nested deeper than %d levels", chain[0], MAX_EXTENDS_DEPTH)
+	}
+
+	job := mappingValue(root.Content, name)
+	if job == nil {
+		return nil, fmt.Errorf("%s extends unknown job %s", chain[len(chain)-2], name)
+	}
+	if job.Kind != yaml.MappingNode {
+		return job, nil
+	}
+	extends := mappingValue(job.Content, "extends")
+	if extends == nil {
+		return job, nil
+	}
+	parents := []string{extends.Value}
+	if extends.Kind == yaml.SequenceNode {
+		parents = []string{}
+		for _, parent := range extends.Content {
+			parents = append(parents, parent.Value)
+		}
+	}
+
+	var merged *yaml.Node
+	for _, parent := range parents {
+		parentJob, err := extendNode(root, parent, chain)
+		if err != nil {
+			return nil, err
+		}
+		merged = mergeNodes(merged, parentJob)
+	}
+	own := *job
+	own.Content = nil
+	for i := 0; i+1 < len(job.Content); i += 2 {
+		if job.Content[i].Value != "extends" {
+			own.Content = append(own.Content, job.Content[i], job.Content[i+1])
+		}
+	}
+	return mergeNodes(merged, &own), nil
+}
+
+// ExpandConfig expands a merged configuration. Hidden jobs (templates) are
+// left out; with job set, only that job is kept.
+func ExpandConfig(content string, job string) (string, error) {
+	expanded, err := expandConfigNode(content, job)
+	if err != nil {
+		return "", err
+	}
+
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	err = encoder.Encode(expanded)
+	if err != nil {
+		return "", fmt.Errorf("error encoding expanded yaml: %w", err)
+	}
+	return buffer.String(), nil
+}
+
+func expandConfigNode(content string, job string) (*yaml.Node, error) {
+	root, err := parseConfigNode(content, "the merged configuration")
+	if err != nil {
+		return nil, err
+	}
+
+	// Hidden jobs are extended too, references may point at what they get
+	// from extends.
+	extended := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		name := root.Content[i].Value
+		value := root.Content[i+1]
+		if !ciKeywords[name] {
+			value, err = extendNode(root, name, nil)
+			if err != nil {
+				return nil, err
+			}
+		}
+		extended.Content = append(extended.Content, root.Content[i], value)
+	}
+	extended, err = resolveReferences(extended, extended, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	expanded := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for i := 0; i+1 < len(extended.Content); i += 2 {
+		name := extended.Content[i].Value
+		if strings.HasPrefix(name, ".") || (job != "" && name != job) {
+			continue
+		}
+		expanded.Content = append(expanded.Content, extended.Content[i], extended.Content[i+1])
+	}
+	if job != "" && len(expanded.Content) == 0 {
+		return nil, fmt.Errorf("there is no job %s", job)
+	}
+	return expanded, nil
+}
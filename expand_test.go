@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandConfig(t *testing.T) {
+	config := `
+stages: [build, deploy]
+.setup:
+  before_script:
+    - apk add curl
+.deploy:
+  stage: deploy
+  variables:
+    REGION: eu
+    TIER: staging
+  script: [deploy]
+.production:
+  extends: .deploy
+  variables:
+    TIER: production
+deploy:
+  extends: [.production]
+  variables:
+    REGION: us
+  before_script:
+    - !reference [.setup, before_script]
+    - echo ready
+`
+	expanded, err := ExpandConfig(config, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `stages: [build, deploy]
+deploy:
+  stage: deploy
+  variables:
+    REGION: us
+    TIER: production
+  script: [deploy]
+  before_script:
+    - apk add curl
+    - echo ready
+`
+	if expanded != want {
+		t.Errorf("ExpandConfig() =\n%s\nwant\n%s", expanded, want)
+	}
+
+	expanded, err = ExpandConfig(config, "deploy")
+	if err != nil || !strings.HasPrefix(expanded, "deploy:\n") {
+		t.Errorf(`ExpandConfig(deploy) = %q, %v, want only the deploy job`, expanded, err)
+	}
+
+	// References see what a job gets through extends.
+	config = `
+.base:
+  script: [make]
+build:
+  extends: .base
+test:
+  script:
+    - !reference [build, script]
+    - make test
+`
+	expanded, err = ExpandConfig(config, "test")
+	want = "test:\n  script:\n    - make\n    - make test\n"
+	if err != nil || expanded != want {
+		t.Errorf("ExpandConfig(test) = %q, %v, want %q", expanded, err, want)
+	}
+
+	tests := []struct {
+		config string
+		job    string
+		want   string
+	}{
+		{"a: {extends: b}\nb: {extends: a}\n", "", "circular extends: a -> b -> a"},
+		{"a: {extends: .missing}\n", "", "a extends unknown job .missing"},
+		{"a: {script: !reference [.missing, script]}\n", "", "!reference [.missing, script] does not exist"},
+		{"a: {script: [x]}\n", "b", "there is no job b"},
+	}
+	for _, test := range tests {
+		_, err := ExpandConfig(test.config, test.job)
+		if err == nil || err.Error() != test.want {
+			t.Errorf(`ExpandConfig(%q) = %v, want %q`, test.config, err, test.want)
+		}
+	}
+}
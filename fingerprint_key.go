@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The key of fingerprints in plans, diffs and prompts. It is kept out of
+// the variables file and out of plans, which are committed and shared, so a
+// fingerprint cannot be checked against guessed values without it. It is
+// read from CREDDER_FINGERPRINT_KEY, CREDDER_FINGERPRINT_KEY_FILE or
+// ~/.config/credder/fingerprint.key, which `credder fingerprint-key` creates.
+
+// NewFingerprintKey returns a random key for fingerprints.
+func NewFingerprintKey() string {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(key)
+}
+
+func defaultFingerprintKeyFile() (string, error) {
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("could not find the config directory: %w", err)
+	}
+	return filepath.Join(config, "credder", "fingerprint.key"), nil
+}
+
+// LoadFingerprintKey returns the configured fingerprint key.
+func LoadFingerprintKey() (string, error) {
+	if key := os.Getenv("CREDDER_FINGERPRINT_KEY"); key != "" {
+		return key, nil
+	}
+	path := os.Getenv("CREDDER_FINGERPRINT_KEY_FILE")
+	if path == "" {
+		defaultPath, err := defaultFingerprintKeyFile()
+		if err != nil {
+			return "", err
+		}
+		path = defaultPath
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", errors.New("no fingerprint key; set CREDDER_FINGERPRINT_KEY or create one with `credder fingerprint-key`")
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not read fingerprint key file: %w", err)
+	}
+	key := strings.TrimSpace(string(content))
+	if key == "" {
+		return "", fmt.Errorf("fingerprint key file %s is empty", path)
+	}
+	return key, nil
+}
+
+// CreateFingerprintKey writes a new key to the default key file, readable
+// only by the user, unless it exists. It returns the path of the file.
+func CreateFingerprintKey() (string, error) {
+	path, err := defaultFingerprintKeyFile()
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return "", fmt.Errorf("could not create fingerprint key directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", fmt.Errorf("could not create fingerprint key file: %w", err)
+	}
+	defer file.Close()
+	_, err = fmt.Fprintln(file, NewFingerprintKey())
+	if err != nil {
+		return "", fmt.Errorf("could not write fingerprint key file: %w", err)
+	}
+	return path, nil
+}
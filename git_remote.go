@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// The git remote used to find the project, set with --remote.
+var gitRemoteName = "origin"
+
+// GitRemote is a git remote URL pointing at a GitLab project.
+type GitRemote struct {
+	Scheme string
+	Host   string
+	Port   string
+	// Path is the full path of the project, including all (sub)groups.
+	Path string
+}
+
+// ParseGitRemote parses the URL forms git accepts for a remote: http(s),
+// ssh:// and git:// URLs (optionally with user and port), and the scp-like
+// [user@]host:path syntax. The .git suffix is optional.
+func ParseGitRemote(raw string) (GitRemote, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return GitRemote{}, errors.New("empty remote URL")
+	}
+
+	remote := GitRemote{}
+	var path string
+	if strings.Contains(raw, "://") {
+		parsed, err := url.Parse(raw)
+		if err != nil {
+			return GitRemote{}, fmt.Errorf("could not parse remote URL %s: %w", raw, err)
+		}
+		remote.Scheme = strings.TrimPrefix(parsed.Scheme, "git+")
+		switch remote.Scheme {
+		case "http", "https", "ssh", "git":
+		default:
+			return GitRemote{}, fmt.Errorf("unsupported remote URL scheme %s in %s", parsed.Scheme, raw)
+		}
+		remote.Host = parsed.Hostname()
+		remote.Port = parsed.Port()
+		path = parsed.Path
+	} else {
+		// scp-like syntax; a colon before any slash separates host and path.
+		colon := strings.Index(raw, ":")
+		slash := strings.Index(raw, "/")
+		if colon < 0 || (slash >= 0 && slash < colon) {
+			return GitRemote{}, fmt.Errorf("remote %s is a local path, not a GitLab URL", raw)
+		}
+		remote.Scheme = "ssh"
+		remote.Host = raw[:colon]
+		if at := strings.LastIndex(remote.Host, "@"); at >= 0 {
+			remote.Host = remote.Host[at+1:]
+		}
+		path = raw[colon+1:]
+	}
+
+	path = strings.Trim(path, "/")
+	path = strings.TrimSuffix(path, ".git")
+	path = strings.TrimSuffix(path, "/")
+	if remote.Host == "" {
+		return GitRemote{}, fmt.Errorf("remote URL %s has no host", raw)
+	}
+	if !strings.Contains(path, "/") {
+		return GitRemote{}, fmt.Errorf("remote URL %s does not point at a project within a group or namespace", raw)
+	}
+	remote.Path = path
+	return remote, nil
+}
+
+// WebURL returns the base URL of the GitLab instance the remote belongs to.
+// SSH remotes are assumed to be served over HTTPS on the default port.
+func (remote GitRemote) WebURL() string {
+	if remote.Scheme == "http" || remote.Scheme == "https" {
+		host := remote.Host
+		if remote.Port != "" {
+			host += ":" + remote.Port
+		}
+		return remote.Scheme + "://" + host
+	}
+	return "https://" + remote.Host
+}
+
+// GetGitRemote reads and parses the URL of the selected git remote.
+func GetGitRemote() (GitRemote, error) {
+	cmd := exec.Command("git", "remote", "get-url", gitRemoteName)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		message := string(output)
+		if strings.Contains(message, "not a git repository") {
+			wd, _ := os.Getwd()
+			return GitRemote{}, fmt.Errorf("%s is not a git repository; run credder inside a project checkout, or use --group or --instance", wd)
+		}
+		if strings.Contains(message, "No such remote") {
+			return GitRemote{}, fmt.Errorf("git remote %s does not exist; choose another with --remote", gitRemoteName)
+		}
+		return GitRemote{}, fmt.Errorf("could not get url of git remote %s: %w: %s", gitRemoteName, err, strings.TrimSpace(message))
+	}
+	return ParseGitRemote(string(output))
+}
+
+// GetGitTopLevel returns the top level directory of the checkout.
+func GetGitTopLevel() (string, error) {
+	output, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return "", fmt.Errorf("could not get the top level directory of the checkout: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// GetGitBranch returns the branch that is checked out.
+func GetGitBranch() (string, error) {
+	output, err := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD").Output()
+	if err != nil {
+		return "", fmt.Errorf("could not get the current branch: %w", err)
+	}
+	branch := strings.TrimSpace(string(output))
+	if branch == "HEAD" {
+		return "", errors.New("no branch is checked out")
+	}
+	return branch, nil
+}
@@ -3,21 +3,22 @@ module credder
 go 1.22.1
 
 require (
-	github.com/go-yaml/yaml v2.1.0+incompatible
+	filippo.io/age v1.2.1
+	github.com/BurntSushi/toml v1.4.0
 	github.com/xanzy/go-gitlab v0.114.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
+	golang.org/x/crypto v0.24.0 // indirect
 	golang.org/x/sys v0.27.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
 
 require (
-	github.com/creack/pty v1.1.24
 	github.com/google/go-querystring v1.1.0 // indirect
 	github.com/hashicorp/go-cleanhttp v0.5.2 // indirect
-	github.com/hashicorp/go-retryablehttp v0.7.7 // indirect
+	github.com/hashicorp/go-retryablehttp v0.7.7
 	github.com/urfave/cli/v3 v3.0.0-beta1
 	golang.org/x/oauth2 v0.24.0 // indirect
 	golang.org/x/time v0.8.0 // indirect
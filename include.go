@@ -0,0 +1,671 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Resolution of include: as GitLab does it, see
+// https://docs.gitlab.com/ee/ci/yaml/includes.html
+//
+// Local paths are relative to the root of the project that holds the
+// including file: the checkout for the pipeline's own files, and the other
+// project (at the same ref) for files from include:project and components.
+
+// GitLab's limits on the number and nesting of includes.
+var MAX_INCLUDES = 150
+var MAX_INCLUDE_DEPTH = 100
+
+// IncludeSource says where an included file comes from. Local files of the
+// checkout have no ProjectID.
+type IncludeSource struct {
+	Kind      string
+	ProjectID int
+	Project   string
+	Ref       string
+	// Path is a file path, a URL or a template name.
+	Path string
+}
+
+func (source IncludeSource) String() string {
+	switch {
+	case source.Kind == "remote", source.Kind == "template":
+		return fmt.Sprintf("%s %s", source.Kind, source.Path)
+	case source.Kind == "trigger":
+		return fmt.Sprintf("trigger:include of job %s", source.Path)
+	case source.ProjectID != 0:
+		return fmt.Sprintf("%s %s@%s:/%s", source.Kind, source.Project, source.Ref, source.Path)
+	}
+	return fmt.Sprintf("%s /%s", source.Kind, source.Path)
+}
+
+// IncludedFile is the content of an included file, with its own includes
+// resolved separately.
+type IncludedFile struct {
+	Source  IncludeSource
+	Content string
+}
+
+type IncludeResolver struct {
+	// Root is the top level directory of the checkout.
+	Root string
+	// Variables are available to rules:if of includes.
+	Variables map[string]string
+	// Files are the included files in merge order: a file comes after the
+	// files it includes.
+	Files []IncludedFile
+
+	stack    []IncludeSource
+	included map[string]bool
+	// count is the number of included files, without the configuration
+	// itself.
+	count      int
+	localFiles []string
+}
+
+func NewIncludeResolver(root string, variables map[string]string) *IncludeResolver {
+	return &IncludeResolver{
+		Root:      root,
+		Variables: variables,
+		included:  make(map[string]bool),
+	}
+}
+
+// ResolveConfig follows the includes of the pipeline configuration at path
+// in the checkout.
+func (resolver *IncludeResolver) ResolveConfig(path string, content string) error {
+	source := IncludeSource{Kind: "local", Path: strings.TrimPrefix(filepath.ToSlash(path), "/")}
+	return resolver.ResolveConfigAt(source, content)
+}
+
+// ResolveConfigAt follows the includes of a pipeline configuration read
+// from source, which may be in another project.
+func (resolver *IncludeResolver) ResolveConfigAt(source IncludeSource, content string) error {
+	resolver.included[source.String()] = true
+	resolver.stack = append(resolver.stack, source)
+	defer func() { resolver.stack = resolver.stack[:len(resolver.stack)-1] }()
+	return resolver.Resolve(content, source)
+}
+
+// Resolve follows the includes of a configuration read from source,
+// recursively. A file included twice is only read once; including a file
+// from itself is an error.
+func (resolver *IncludeResolver) Resolve(content string, source IncludeSource) error {
+	if len(resolver.stack) > MAX_INCLUDE_DEPTH {
+		return fmt.Errorf("includes are nested deeper than %d levels", MAX_INCLUDE_DEPTH)
+	}
+	_, body := splitSpecHeader(content)
+	root := map[string]any{}
+	err := yaml.Unmarshal([]byte(body), &root)
+	if err != nil {
+		return fmt.Errorf("error unmarshalling yaml of %s: %w", source, err)
+	}
+
+	entries, err := includeEntries(root["include"])
+	if err != nil {
+		return fmt.Errorf("invalid include in %s: %w", source, err)
+	}
+	for _, entry := range entries {
+		matches, err := resolver.rulesMatch(entry["rules"])
+		if err != nil {
+			return fmt.Errorf("invalid include rules in %s: %w", source, err)
+		}
+		if !matches {
+			continue
+		}
+		sources, err := resolver.sources(entry, source)
+		if err != nil {
+			return fmt.Errorf("invalid include in %s: %w", source, err)
+		}
+		inputs, _ := yamlMap(entry["inputs"])
+		for _, included := range sources {
+			err = resolver.include(included, inputs)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (resolver *IncludeResolver) include(source IncludeSource, inputs map[string]any) error {
+	for i, parent := range resolver.stack {
+		if parent.String() == source.String() {
+			cycle := []string{}
+			for _, file := range resolver.stack[i:] {
+				cycle = append(cycle, file.String())
+			}
+			return fmt.Errorf("include cycle: %s -> %s", strings.Join(cycle, " -> "), source)
+		}
+	}
+	// A file included with other inputs has other content.
+	key := source.String()
+	if len(inputs) > 0 {
+		normalized, err := json.Marshal(inputs)
+		if err != nil {
+			return fmt.Errorf("invalid inputs of %s: %w", source, err)
+		}
+		key += " with inputs " + string(normalized)
+	}
+	if resolver.included[key] {
+		return nil
+	}
+	if resolver.count >= MAX_INCLUDES {
+		return fmt.Errorf("more than %d includes", MAX_INCLUDES)
+	}
+	resolver.included[key] = true
+	resolver.count++
+
+	content, err := resolver.fetch(source)
+	if err != nil {
+		return fmt.Errorf("could not include %s: %w", source, err)
+	}
+	content, err = applyInputs(content, inputs)
+	if err != nil {
+		return fmt.Errorf("could not include %s: %w", source, err)
+	}
+
+	resolver.stack = append(resolver.stack, source)
+	err = resolver.Resolve(content, source)
+	resolver.stack = resolver.stack[:len(resolver.stack)-1]
+	if err != nil {
+		return err
+	}
+	resolver.Files = append(resolver.Files, IncludedFile{Source: source, Content: content})
+	return nil
+}
+
+// includeEntries normalizes the forms of include: a string, a hash, or a
+// list of both. A string is a local path, or a remote file when it is a URL.
+func includeEntries(value any) ([]map[string]any, error) {
+	items := []any{}
+	switch typed := value.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		items = typed
+	default:
+		items = append(items, typed)
+	}
+
+	entries := []map[string]any{}
+	for _, item := range items {
+		if path, ok := item.(string); ok {
+			if strings.Contains(path, "://") {
+				entries = append(entries, map[string]any{"remote": path})
+			} else {
+				entries = append(entries, map[string]any{"local": path})
+			}
+			continue
+		}
+		entry, ok := yamlMap(item)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a path or a hash", item)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// expand replaces $VAR and ${VAR} in a value of an include with the
+// resolver's variables, as GitLab does for local, project, ref, file and
+// remote. Unknown variables are left as they are.
+func (resolver *IncludeResolver) expand(value any) string {
+	text := fmt.Sprint(value)
+	return variableReference.ReplaceAllStringFunc(text, func(match string) string {
+		groups := variableReference.FindStringSubmatch(match)
+		name := groups[2]
+		if name == "" {
+			name = groups[1]
+		}
+		if expanded, ok := resolver.Variables[name]; ok {
+			return expanded
+		}
+		return match
+	})
+}
+
+// sources lists the files an include entry stands for.
+func (resolver *IncludeResolver) sources(entry map[string]any, parent IncludeSource) ([]IncludeSource, error) {
+	switch {
+	case entry["local"] != nil:
+		path := strings.TrimPrefix(resolver.expand(entry["local"]), "/")
+		source := IncludeSource{Kind: "local", Path: path}
+		// Local files of another project come from that project.
+		if parent.ProjectID != 0 {
+			source.ProjectID, source.Project, source.Ref = parent.ProjectID, parent.Project, parent.Ref
+		}
+		if !strings.ContainsAny(path, "*?{") {
+			return []IncludeSource{source}, nil
+		}
+		files, err := resolver.projectFiles(source.ProjectID, source.Ref)
+		if err != nil {
+			return nil, err
+		}
+		sources := []IncludeSource{}
+		for _, file := range files {
+			if GlobMatch(path, file) && (strings.HasSuffix(file, ".yml") || strings.HasSuffix(file, ".yaml")) {
+				match := source
+				match.Path = file
+				sources = append(sources, match)
+			}
+		}
+		if len(sources) == 0 {
+			return nil, fmt.Errorf("local %s matches no .yml or .yaml files", path)
+		}
+		return sources, nil
+
+	case entry["project"] != nil:
+		project := strings.Trim(resolver.expand(entry["project"]), "/")
+		projectId, err := GetProjectIdFromPath(project)
+		if err != nil {
+			return nil, err
+		}
+		ref := ""
+		if entry["ref"] != nil {
+			ref = resolver.expand(entry["ref"])
+		} else {
+			ref, err = GetDefaultBranch(projectId)
+			if err != nil {
+				return nil, err
+			}
+		}
+		files := yamlStrings(entry["file"])
+		if len(files) == 0 {
+			return nil, fmt.Errorf("project %s is included without file", project)
+		}
+		sources := []IncludeSource{}
+		for _, file := range files {
+			sources = append(sources, IncludeSource{
+				Kind:      "project",
+				ProjectID: projectId,
+				Project:   project,
+				Ref:       ref,
+				Path:      strings.TrimPrefix(resolver.expand(file), "/"),
+			})
+		}
+		return sources, nil
+
+	case entry["remote"] != nil:
+		return []IncludeSource{{Kind: "remote", Path: resolver.expand(entry["remote"])}}, nil
+
+	case entry["template"] != nil:
+		return []IncludeSource{{Kind: "template", Path: fmt.Sprint(entry["template"])}}, nil
+
+	case entry["component"] != nil:
+		source, err := resolver.componentSource(fmt.Sprint(entry["component"]))
+		if err != nil {
+			return nil, err
+		}
+		return []IncludeSource{source}, nil
+	}
+	return nil, fmt.Errorf("%v is not a local, project, remote, template or component include", entry)
+}
+
+func (resolver *IncludeResolver) fetch(source IncludeSource) (string, error) {
+	switch {
+	case source.Kind == "remote":
+		return GetRemoteFile(source.Path)
+	case source.Kind == "template":
+		return GetCiTemplate(source.Path)
+	case source.ProjectID != 0:
+		return GetFileFromProjectIdAndPath(source.ProjectID, source.Path, source.Ref)
+	}
+	content, err := os.ReadFile(filepath.Join(resolver.Root, filepath.FromSlash(source.Path)))
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("local file %s does not exist", source.Path)
+	}
+	return string(content), err
+}
+
+// projectFiles lists the files of the checkout, or of another project.
+func (resolver *IncludeResolver) projectFiles(projectId int, ref string) ([]string, error) {
+	if projectId != 0 {
+		return ListProjectFiles(projectId, ref)
+	}
+	if resolver.localFiles != nil {
+		return resolver.localFiles, nil
+	}
+	files := []string{}
+	err := filepath.WalkDir(resolver.Root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !entry.IsDir() {
+			relative, err := filepath.Rel(resolver.Root, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(relative))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not list files: %w", err)
+	}
+	resolver.localFiles = files
+	return files, nil
+}
+
+// GlobMatch matches a path against a pattern of include:local or
+// rules:exists: * matches within a directory, ** across directories, and
+// {a,b} matches either.
+func GlobMatch(pattern string, path string) bool {
+	var expression strings.Builder
+	expression.WriteString("^")
+	braces := 0
+	for i := 0; i < len(pattern); i++ {
+		char := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expression.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expression.WriteString(".*")
+			i++
+		case char == '*':
+			expression.WriteString("[^/]*")
+		case char == '?':
+			expression.WriteString("[^/]")
+		case char == '{':
+			expression.WriteString("(?:")
+			braces++
+		case char == '}' && braces > 0:
+			expression.WriteString(")")
+			braces--
+		case char == ',' && braces > 0:
+			expression.WriteString("|")
+		default:
+			expression.WriteString(regexp.QuoteMeta(string(char)))
+		}
+	}
+	expression.WriteString("$")
+	matcher, err := regexp.Compile(expression.String())
+	return err == nil && matcher.MatchString(strings.TrimPrefix(path, "/"))
+}
+
+// rulesMatch evaluates the rules of an include. Without rules the file is
+// included; rules:changes cannot be known while linting and always match.
+func (resolver *IncludeResolver) rulesMatch(value any) (bool, error) {
+	if value == nil {
+		return true, nil
+	}
+	rules, ok := value.([]any)
+	if !ok {
+		return false, fmt.Errorf("rules must be a list")
+	}
+	for _, item := range rules {
+		rule, ok := yamlMap(item)
+		if !ok {
+			return false, fmt.Errorf("rule %v is not a hash", item)
+		}
+		if condition, ok := rule["if"].(string); ok {
+			matches, err := EvaluateRule(condition, resolver.Variables)
+			if err != nil {
+				return false, err
+			}
+			if !matches {
+				continue
+			}
+		}
+		if rule["exists"] != nil {
+			exists := rule["exists"]
+			if detailed, ok := yamlMap(exists); ok {
+				exists = detailed["paths"]
+			}
+			files, err := resolver.projectFiles(0, "")
+			if err != nil {
+				return false, err
+			}
+			found := false
+			for _, pattern := range yamlStrings(exists) {
+				for _, file := range files {
+					found = found || GlobMatch(strings.TrimPrefix(pattern, "/"), file)
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+		return rule["when"] != "never", nil
+	}
+	return false, nil
+}
+
+// componentSource finds the file of a CI/CD component, given as
+// host/project/path/name@version.
+func (resolver *IncludeResolver) componentSource(reference string) (IncludeSource, error) {
+	instance, err := url.Parse(GitlabURL())
+	if err != nil {
+		return IncludeSource{}, err
+	}
+	reference = strings.ReplaceAll(reference, "$CI_SERVER_FQDN", instance.Host)
+	reference = strings.ReplaceAll(reference, "$CI_SERVER_HOST", instance.Hostname())
+
+	address, version, found := strings.Cut(reference, "@")
+	if !found {
+		return IncludeSource{}, fmt.Errorf("component %s has no @version", reference)
+	}
+	host, path, _ := strings.Cut(address, "/")
+	if host != instance.Host {
+		return IncludeSource{}, fmt.Errorf("component %s is not on %s", reference, GitlabURL())
+	}
+	slash := strings.LastIndex(path, "/")
+	if slash < 0 {
+		return IncludeSource{}, fmt.Errorf("component %s has no project", reference)
+	}
+	project, name := path[:slash], path[slash+1:]
+
+	projectId, err := GetProjectIdFromPath(project)
+	if err != nil {
+		return IncludeSource{}, err
+	}
+	ref, err := componentRef(projectId, version)
+	if err != nil {
+		return IncludeSource{}, fmt.Errorf("component %s: %w", reference, err)
+	}
+	files, err := ListProjectFiles(projectId, ref)
+	if err != nil {
+		return IncludeSource{}, err
+	}
+	for _, candidate := range []string{"templates/" + name + ".yml", "templates/" + name + "/template.yml"} {
+		for _, file := range files {
+			if file == candidate {
+				return IncludeSource{Kind: "component", ProjectID: projectId, Project: project, Ref: ref, Path: file}, nil
+			}
+		}
+	}
+	return IncludeSource{}, fmt.Errorf("component %s: %s@%s has no templates/%s.yml or templates/%s/template.yml", reference, project, ref, name, name)
+}
+
+// componentRef turns a component version into a ref: ~latest and partial
+// versions such as 1 or 1.2 pick the highest matching release.
+func componentRef(projectId int, version string) (string, error) {
+	prefix, isPartial := parseVersion(version)
+	if version != "~latest" && (!isPartial || len(prefix) == 3) {
+		return version, nil
+	}
+	if version == "~latest" {
+		prefix = nil
+	}
+	tags, err := ListReleaseTags(projectId)
+	if err != nil {
+		return "", err
+	}
+	candidates := []string{}
+	for _, tag := range tags {
+		numbers, ok := parseVersion(tag)
+		if !ok || len(numbers) != 3 {
+			continue
+		}
+		matches := true
+		for i, number := range prefix {
+			matches = matches && numbers[i] == number
+		}
+		if matches {
+			candidates = append(candidates, tag)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no release matches %s", version)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, _ := parseVersion(candidates[i])
+		b, _ := parseVersion(candidates[j])
+		for k := range a {
+			if a[k] != b[k] {
+				return a[k] > b[k]
+			}
+		}
+		return false
+	})
+	return candidates[0], nil
+}
+
+// parseVersion parses 1, 1.2 or 1.2.3; pre-releases do not count.
+func parseVersion(version string) ([]int, bool) {
+	parts := strings.Split(version, ".")
+	if len(parts) > 3 {
+		return nil, false
+	}
+	numbers := []int{}
+	for _, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 {
+			return nil, false
+		}
+		numbers = append(numbers, number)
+	}
+	return numbers, true
+}
+
+var inputReference = regexp.MustCompile(`\$\[\[\s*inputs\.([A-Za-z0-9_-]+)\s*(?:\|[^\]]*)?\]\]`)
+
+// splitSpecHeader splits a file with a spec: header into the header and the
+// configuration below the --- line.
+func splitSpecHeader(content string) (map[string]any, string) {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) != "---" {
+			continue
+		}
+		header := map[string]any{}
+		err := yaml.Unmarshal([]byte(strings.Join(lines[:i], "\n")), &header)
+		if err != nil || header["spec"] == nil {
+			break
+		}
+		return header, strings.Join(lines[i+1:], "\n")
+	}
+	return nil, content
+}
+
+// applyInputs interpolates $[[ inputs.name ]] with the inputs of an include
+// and the defaults of the file's spec:inputs.
+func applyInputs(content string, given map[string]any) (string, error) {
+	header, body := splitSpecHeader(content)
+	if header == nil {
+		if len(given) > 0 {
+			return "", fmt.Errorf("inputs are given, but the file has no spec:inputs")
+		}
+		return content, nil
+	}
+	spec, _ := yamlMap(header["spec"])
+	declared, _ := yamlMap(spec["inputs"])
+
+	values := make(map[string]string)
+	for name, value := range given {
+		if _, found := declared[name]; !found {
+			return "", fmt.Errorf("unknown input %s", name)
+		}
+		values[name] = fmt.Sprint(value)
+	}
+	for name, item := range declared {
+		if _, found := values[name]; found {
+			continue
+		}
+		options, _ := yamlMap(item)
+		if options == nil || options["default"] == nil {
+			return "", fmt.Errorf("input %s is required", name)
+		}
+		values[name] = fmt.Sprint(options["default"])
+	}
+
+	var missing error
+	body = inputReference.ReplaceAllStringFunc(body, func(reference string) string {
+		name := inputReference.FindStringSubmatch(reference)[1]
+		value, found := values[name]
+		if !found {
+			missing = fmt.Errorf("input %s is used but not declared", name)
+		}
+		return value
+	})
+	return body, missing
+}
+
+// SetRefVariables sets the variables of the branch or tag a pipeline runs
+// for; a tag pipeline has CI_COMMIT_TAG and no CI_COMMIT_BRANCH.
+func SetRefVariables(variables map[string]string, ref string, tag bool) {
+	delete(variables, "CI_COMMIT_BRANCH")
+	delete(variables, "CI_COMMIT_TAG")
+	variables["CI_COMMIT_REF_NAME"] = ref
+	if tag {
+		variables["CI_COMMIT_TAG"] = ref
+	} else {
+		variables["CI_COMMIT_BRANCH"] = ref
+	}
+}
+
+// PipelineVariables are the variables rules:if of includes can use while
+// linting: the global variables of the configuration, the variables file's
+// variables for all environments, and what is known of the pipeline.
+func PipelineVariables(content string, local ProjectSecrets) map[string]string {
+	variables := make(map[string]string)
+	for _, secret := range local.Variables {
+		if secret.Environment == "*" {
+			variables[secret.Key] = secret.Value
+		}
+	}
+	root := map[string]any{}
+	if yaml.Unmarshal([]byte(content), &root) == nil {
+		for name, value := range variableValues(root["variables"]) {
+			variables[name] = value
+		}
+	}
+
+	variables["CI"] = "true"
+	variables["GITLAB_CI"] = "true"
+	variables["CI_PIPELINE_SOURCE"] = "push"
+	variables["CI_SERVER_URL"] = GitlabURL()
+	if instance, err := url.Parse(GitlabURL()); err == nil {
+		variables["CI_SERVER_HOST"] = instance.Hostname()
+		variables["CI_SERVER_FQDN"] = instance.Host
+	}
+	if remote, err := GetGitRemote(); err == nil {
+		variables["CI_PROJECT_PATH"] = remote.Path
+		slash := strings.LastIndex(remote.Path, "/")
+		variables["CI_PROJECT_NAMESPACE"] = remote.Path[:max(slash, 0)]
+		variables["CI_PROJECT_NAME"] = remote.Path[slash+1:]
+	}
+	if branch, err := GetGitBranch(); err == nil {
+		SetRefVariables(variables, branch, false)
+	}
+	if projectId, err := GetProjectID(); err == nil {
+		if defaultBranch, err := GetDefaultBranch(projectId); err == nil {
+			variables["CI_DEFAULT_BRANCH"] = defaultBranch
+		}
+	}
+	return variables
+}
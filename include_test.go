@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"ci/*.yml", "ci/build.yml", true},
+		{"ci/*.yml", "ci/jobs/build.yml", false},
+		{"ci/**.yml", "ci/jobs/build.yml", true},
+		{"ci/**/*.yml", "ci/build.yml", true},
+		{"ci/**/*.yml", "ci/jobs/build.yml", true},
+		{"ci/*.{yml,yaml}", "ci/build.yaml", true},
+		{"/ci/build.yml", "ci/build.yml", false},
+		{"Dockerfile", "Dockerfile", true},
+	}
+	for _, test := range tests {
+		if got := GlobMatch(test.pattern, test.path); got != test.want {
+			t.Errorf(`GlobMatch(%q, %q) = %v, want %v`, test.pattern, test.path, got, test.want)
+		}
+	}
+}
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+	for path, content := range files {
+		full := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestResolveLocalIncludes(t *testing.T) {
+	root := writeFiles(t, map[string]string{
+		"ci/build.yml":  "include: /ci/common/base.yml\nbuild: {script: [make]}\n",
+		"ci/deploy.yml": "deploy: {script: [deploy]}\n",
+		"ci/test.yml": "spec:\n  inputs:\n    target:\n      default: staging\n---\n" +
+			"test: {script: [test $[[ inputs.target ]]]}\n",
+		"ci/common/base.yml": ".base: {image: alpine}\n",
+		"Dockerfile":         "FROM alpine\n",
+	})
+	config := `
+include:
+  - local: $CI_DIR/build.yml
+  - local: /ci/test.yml
+    inputs:
+      target: production
+  - local: ci/*.yml
+  - local: ci/missing.yml
+    rules:
+      - exists: [NoSuchFile]
+  - local: ci/missing.yml
+    rules:
+      - if: $DEPLOY == "false"
+`
+	resolver := NewIncludeResolver(root, map[string]string{"DEPLOY": "true", "CI_DIR": "ci"})
+	err := resolver.ResolveConfig(".gitlab-ci.yml", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{}
+	for _, file := range resolver.Files {
+		paths = append(paths, file.Source.Path)
+	}
+	// ci/test.yml is included again by the glob, with other (default) inputs.
+	want := []string{"ci/common/base.yml", "ci/build.yml", "ci/test.yml", "ci/deploy.yml", "ci/test.yml"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Fatalf(`Files = %v, want %v`, paths, want)
+	}
+	if !strings.Contains(resolver.Files[2].Content, "test production") {
+		t.Errorf(`inputs were not applied: %q`, resolver.Files[2].Content)
+	}
+	if !strings.Contains(resolver.Files[4].Content, "test staging") {
+		t.Errorf(`default inputs were not applied: %q`, resolver.Files[4].Content)
+	}
+}
+
+func TestResolveIncludeErrors(t *testing.T) {
+	root := writeFiles(t, map[string]string{
+		"a.yml":          "include: /b.yml\n",
+		"b.yml":          "include: /a.yml\n",
+		"spec.yml":       "spec:\n  inputs:\n    target:\n---\njob: {script: [echo]}\n",
+		".gitlab-ci.yml": "include: /self.yml\n",
+		"self.yml":       "include: .gitlab-ci.yml\n",
+	})
+	tests := []struct {
+		config string
+		want   string
+	}{
+		{"include: a.yml\n", "include cycle: local /a.yml -> local /b.yml -> local /a.yml"},
+		{"include: self.yml\n", "include cycle: local /.gitlab-ci.yml -> local /self.yml -> local /.gitlab-ci.yml"},
+		{"include: missing.yml\n", "local file missing.yml does not exist"},
+		{"include: spec.yml\n", "input target is required"},
+		{"include: 'nothing/*.yml'\n", "matches no .yml or .yaml files"},
+		{"include: {unknown: x}\n", "is not a local, project, remote, template or component include"},
+	}
+	for _, test := range tests {
+		resolver := NewIncludeResolver(root, nil)
+		err := resolver.ResolveConfig(".gitlab-ci.yml", test.config)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf(`ResolveConfig(%q) = %v, want %q`, test.config, err, test.want)
+		}
+	}
+}
+
+func TestIncludeLimit(t *testing.T) {
+	files := map[string]string{"ci/extra.yml": "extra: {script: [test]}\n"}
+	for i := 0; i < MAX_INCLUDES; i++ {
+		files[fmt.Sprintf("ci/jobs/%03d.yml", i)] = fmt.Sprintf("job-%d: {script: [test]}\n", i)
+	}
+	root := writeFiles(t, files)
+
+	// The configuration itself does not count.
+	resolver := NewIncludeResolver(root, nil)
+	err := resolver.ResolveConfig(".gitlab-ci.yml", "include: ci/jobs/*.yml\n")
+	if err != nil || len(resolver.Files) != MAX_INCLUDES {
+		t.Fatalf("ResolveConfig() = %v with %d files, want %d files", err, len(resolver.Files), MAX_INCLUDES)
+	}
+
+	resolver = NewIncludeResolver(root, nil)
+	err = resolver.ResolveConfig(".gitlab-ci.yml", "include: [ci/jobs/*.yml, ci/extra.yml]\n")
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("more than %d includes", MAX_INCLUDES)) {
+		t.Fatalf("ResolveConfig() = %v, want more than %d includes", err, MAX_INCLUDES)
+	}
+}
+
+func TestResolveIncludesForRef(t *testing.T) {
+	root := writeFiles(t, map[string]string{
+		"ci/release.yml": "release: {script: [release]}\n",
+		"ci/branch.yml":  "branch: {script: [test]}\n",
+	})
+	config := `
+include:
+  - local: ci/release.yml
+    rules:
+      - if: $CI_COMMIT_TAG
+  - local: ci/branch.yml
+    rules:
+      - if: $CI_COMMIT_BRANCH == "main"
+`
+	tests := []struct {
+		ref  string
+		tag  bool
+		want []string
+	}{
+		{"v1.0.0", true, []string{"ci/release.yml"}},
+		{"main", false, []string{"ci/branch.yml"}},
+		{"feature", false, []string{}},
+	}
+	for _, test := range tests {
+		// Variables of the checkout are replaced by those of the ref.
+		variables := map[string]string{"CI_COMMIT_BRANCH": "main", "CI_COMMIT_REF_NAME": "main"}
+		SetRefVariables(variables, test.ref, test.tag)
+		resolver := NewIncludeResolver(root, variables)
+		err := resolver.ResolveConfig(".gitlab-ci.yml", config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths := []string{}
+		for _, file := range resolver.Files {
+			paths = append(paths, file.Source.Path)
+		}
+		if !reflect.DeepEqual(paths, test.want) {
+			t.Errorf("includes for %s = %v, want %v", test.ref, paths, test.want)
+		}
+	}
+}
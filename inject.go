@@ -1,18 +1,21 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 )
 
 // Return a copy of the project with filenames injected
 func (project ProjectSecrets) InjectFiles() ProjectSecrets {
 	newProject := ProjectSecrets{
-		ProjectID: project.ProjectID,
-		Variables: make([]Secret, len(project.Variables)),
+		ProjectID:     project.ProjectID,
+		GroupID:       project.GroupID,
+		Instance:      project.Instance,
+		GitlabURL:     project.GitlabURL,
+		AgeRecipients: project.AgeRecipients,
+		Comments:      project.Comments,
+		Variables:     make([]Secret, len(project.Variables)),
 	}
 
 	for i, secret := range project.Variables {
@@ -46,26 +49,16 @@ func (project ProjectSecrets) InjectFiles() ProjectSecrets {
 
 // Return a copy of the project with secrets injected
 func (project ProjectSecrets) InjectSecrets() ProjectSecrets {
-	// marshall to json with indents
-	localJson, err := json.MarshalIndent(project, "", "  ")
-	if err != nil {
-		fmt.Println("Error encoding JSON:", err)
-		return ProjectSecrets{}
-	}
-	cmd := exec.Command("bash", "-c", fmt.Sprintf("echo '%s' | op inject", localJson))
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		fmt.Println("Error injecting secrets:", err)
-		fmt.Println(string(output))
-		log.Fatalln("Could not inject secrets")
-		return ProjectSecrets{}
-	}
-	var injected ProjectSecrets
-	err = json.Unmarshal(output, &injected)
-	if err != nil {
-		fmt.Println("Error decoding JSON:", err)
-		return ProjectSecrets{}
+	injected := project
+	injected.Variables = make([]Secret, len(project.Variables))
+	for i, secret := range project.Variables {
+		value, err := ResolveReferences(secret.Value)
+		if err != nil {
+			fmt.Printf("Error injecting secrets for %s (%s): %s\n", secret.Key, secret.Environment, err)
+			log.Fatalln("Could not inject secrets")
+		}
+		secret.Value = value
+		injected.Variables[i] = secret
 	}
-
 	return injected
 }
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// FileComments are the comments of a JSONC variables file: the ones before
+// the first variable, and the ones attached to each variable, by key.
+// Comments directly above a variable, or inside it, belong to it.
+type FileComments struct {
+	Header    []string
+	Variables map[string][]string
+}
+
+type jsonComment struct {
+	Start int
+	End   int
+	Lines []string
+}
+
+// stripComments blanks out // and /* */ comments outside strings, keeping
+// all offsets (and so error positions) intact, and returns the comments.
+func stripComments(content []byte) ([]byte, []jsonComment) {
+	stripped := append([]byte(nil), content...)
+	comments := []jsonComment{}
+	inString := false
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		if inString {
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		if c == '"' {
+			inString = true
+			continue
+		}
+		if c != '/' || i+1 >= len(content) {
+			continue
+		}
+		end := -1
+		switch content[i+1] {
+		case '/':
+			end = bytes.IndexByte(content[i:], '\n')
+			if end < 0 {
+				end = len(content)
+			} else {
+				end += i
+			}
+		case '*':
+			end = bytes.Index(content[i+2:], []byte("*/"))
+			if end < 0 {
+				end = len(content)
+			} else {
+				end += i + 4
+			}
+		}
+		if end < 0 {
+			continue
+		}
+		lines := []string{}
+		for _, line := range strings.Split(string(content[i:end]), "\n") {
+			lines = append(lines, strings.TrimSpace(line))
+		}
+		comments = append(comments, jsonComment{Start: i, End: end, Lines: lines})
+		for j := i; j < end; j++ {
+			if stripped[j] != '\n' {
+				stripped[j] = ' '
+			}
+		}
+		i = end - 1
+	}
+	return stripped, comments
+}
+
+type variableSpan struct {
+	Start int
+	End   int
+	Key   string
+}
+
+// variableSpans finds the elements of the top-level variables array in
+// (comment free) JSON, with their offsets and keys, and the offset of the
+// array itself (-1 when there is none).
+func variableSpans(content []byte) ([]variableSpan, int) {
+	type frame struct {
+		object  bool
+		wantKey bool
+		key     string
+	}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	stack := []frame{}
+	spans := []variableSpan{}
+	arrayStart := -1
+	inVariables := false
+	for {
+		start := int(decoder.InputOffset())
+		token, err := decoder.Token()
+		if err != nil {
+			return spans, arrayStart
+		}
+		delim, isDelim := token.(json.Delim)
+		if isDelim && (delim == '}' || delim == ']') {
+			stack = stack[:len(stack)-1]
+			if inVariables && len(stack) == 2 {
+				spans[len(spans)-1].End = int(decoder.InputOffset())
+			}
+			if inVariables && len(stack) == 1 {
+				inVariables = false
+			}
+			if len(stack) > 0 && stack[len(stack)-1].object {
+				stack[len(stack)-1].wantKey = true
+			}
+			continue
+		}
+		if len(stack) > 0 && stack[len(stack)-1].wantKey {
+			stack[len(stack)-1].key, _ = token.(string)
+			stack[len(stack)-1].wantKey = false
+			continue
+		}
+		if isDelim {
+			stack = append(stack, frame{object: delim == '{', wantKey: delim == '{'})
+			if len(stack) == 2 && delim == '[' && stack[0].key == "variables" {
+				inVariables = true
+				arrayStart = start + bytes.IndexByte(content[start:], '[')
+			}
+			if inVariables && len(stack) == 3 && delim == '{' {
+				spans = append(spans, variableSpan{Start: start + bytes.IndexByte(content[start:], '{')})
+			}
+			continue
+		}
+		if inVariables && len(stack) == 3 && stack[2].key == "key" {
+			spans[len(spans)-1].Key, _ = token.(string)
+		}
+		if len(stack) > 0 && stack[len(stack)-1].object {
+			stack[len(stack)-1].wantKey = true
+		}
+	}
+}
+
+// attachComments assigns each comment to the variable it precedes or is
+// part of. Comments before the variables array are file comments, and
+// comments after the last variable stay with the last variable.
+func attachComments(stripped []byte, comments []jsonComment) FileComments {
+	attached := FileComments{Variables: make(map[string][]string)}
+	spans, arrayStart := variableSpans(stripped)
+	for _, comment := range comments {
+		if len(spans) == 0 || comment.Start < arrayStart {
+			attached.Header = append(attached.Header, comment.Lines...)
+			continue
+		}
+		owner := len(spans) - 1
+		for i, span := range spans {
+			if comment.Start < span.End {
+				owner = i
+				break
+			}
+		}
+		key := spans[owner].Key
+		attached.Variables[key] = append(attached.Variables[key], comment.Lines...)
+	}
+	return attached
+}
+
+// insertComments writes the comments back into freshly encoded JSON: the
+// header above the document and variable comments above their variable.
+func insertComments(content []byte, comments FileComments) []byte {
+	spans, _ := variableSpans(content)
+	sort.Slice(spans, func(i, j int) bool { return spans[i].Start > spans[j].Start })
+	for _, span := range spans {
+		lines := comments.Variables[span.Key]
+		if len(lines) == 0 {
+			continue
+		}
+		lineStart := bytes.LastIndexByte(content[:span.Start], '\n') + 1
+		indent := string(content[lineStart:span.Start])
+		var block strings.Builder
+		for _, line := range lines {
+			block.WriteString(indent + line + "\n")
+		}
+		content = append(content[:lineStart], append([]byte(block.String()), content[lineStart:]...)...)
+	}
+	if len(comments.Header) > 0 {
+		header := strings.Join(comments.Header, "\n") + "\n"
+		content = append([]byte(header), content...)
+	}
+	return content
+}
+
+var jsoncCodec = fileCodec{
+	Name: "JSONC",
+	Marshal: func(value any) ([]byte, error) {
+		content, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if project, ok := value.(*NestedProjectSecrets); ok {
+			content = insertComments(content, project.Comments)
+		}
+		return content, nil
+	},
+	Unmarshal: func(filename string, content []byte, value any) error {
+		stripped, comments := stripComments(content)
+		err := decodeStrictJSON(filename, stripped, value)
+		if err != nil {
+			return err
+		}
+		if project, ok := value.(*NestedProjectSecrets); ok {
+			project.Comments = attachComments(stripped, comments)
+		}
+		return nil
+	},
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestJsoncComments(t *testing.T) {
+	content := `// Variables of the deploy project
+{
+  "project_id": 1,
+  "variables": [
+    // Used by the deploy job
+    {
+      "key": "DEPLOY_TOKEN", // rotated yearly
+      "value": "op://deploy/token"
+    },
+    /* Old, remove once migrated */
+    {
+      "key": "LEGACY",
+      "value": "x"
+    }
+    // end of variables
+  ]
+}
+`
+	project := NestedProjectSecrets{}
+	err := jsoncCodec.Unmarshal("vars.jsonc", []byte(content), &project)
+	if err != nil {
+		t.Fatalf("Unmarshal() = %v", err)
+	}
+	want := map[string][]string{
+		"DEPLOY_TOKEN": {"// Used by the deploy job", "// rotated yearly"},
+		"LEGACY":       {"/* Old, remove once migrated */", "// end of variables"},
+	}
+	if len(project.Comments.Header) != 1 || project.Comments.Header[0] != "// Variables of the deploy project" {
+		t.Fatalf("Unmarshal() header = %q", project.Comments.Header)
+	}
+	for key, lines := range want {
+		if len(project.Comments.Variables[key]) != len(lines) {
+			t.Fatalf("Unmarshal() comments of %s = %q, want %q", key, project.Comments.Variables[key], lines)
+		}
+		for i, line := range lines {
+			if project.Comments.Variables[key][i] != line {
+				t.Fatalf("Unmarshal() comments of %s = %q, want %q", key, project.Comments.Variables[key], lines)
+			}
+		}
+	}
+
+	// Removing a variable drops its comments; an added variable has none.
+	value := "op://deploy/url"
+	project.Variables = []NestedSecret{project.Variables[0], {Key: "DEPLOY_URL", Value: &value}}
+	written, err := jsoncCodec.Marshal(&project)
+	if err != nil {
+		t.Fatalf("Marshal() = %v", err)
+	}
+	wantWritten := `// Variables of the deploy project
+{
+  "project_id": 1,
+  "variables": [
+    // Used by the deploy job
+    // rotated yearly
+    {
+      "key": "DEPLOY_TOKEN",
+      "value": "op://deploy/token"
+    },
+    {
+      "key": "DEPLOY_URL",
+      "value": "op://deploy/url"
+    }
+  ]
+}`
+	if string(written) != wantWritten {
+		t.Fatalf("Marshal() = %s, want %s", written, wantWritten)
+	}
+
+	// Written comments are read back the same.
+	reread := NestedProjectSecrets{}
+	err = jsoncCodec.Unmarshal("vars.jsonc", written, &reread)
+	if err != nil {
+		t.Fatalf("Unmarshal() of written = %v", err)
+	}
+	if len(reread.Comments.Variables["DEPLOY_TOKEN"]) != 2 || len(reread.Comments.Variables["DEPLOY_URL"]) != 0 || len(reread.Comments.Header) != 1 {
+		t.Fatalf("Unmarshal() of written comments = %v", reread.Comments)
+	}
+}
@@ -4,37 +4,55 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
+	"time"
 
-	"github.com/go-yaml/yaml"
+	"github.com/xanzy/go-gitlab"
+	"gopkg.in/yaml.v3"
 )
 
 // Linting consists of 2 passes:
 // 1. Merge all includes and send to gitlab lint api
 // 2. Apply extra linting rules
-//    - check variables
+//    - check variables (lint_variables.go)
 //    - check args of helm install
+// Both are repeated for the child and multi-project pipelines of trigger jobs.
 
-// When linting all network requests are cached in /tmp
-// To clear the cache, run `credder lint clear-cache`
+// When linting, network requests are cached in the user's cache directory
+// for LINT_CACHE_TTL. To clear the cache, delete credder/lint-cache.json
+// there.
 
 // Some things to consider while doing the first pass
-// - you can override a job with the same name if the job comes from an external include
+// - you can override a job with the same name if the job comes from an external include,
+//   hashes are deep merged in include order with the including file last (merge.go)
 
-var lintCache map[string]string = make(map[string]string)
+// Branches, trees, releases and project settings change, so cached lookups
+// are only used for a short while.
+var LINT_CACHE_TTL = 10 * time.Minute
+
+type lintCacheEntry struct {
+	Value  string    `json:"value"`
+	Stored time.Time `json:"stored"`
+}
+
+var lintCache map[string]lintCacheEntry = make(map[string]lintCacheEntry)
 
 func GetLintCache(key string) (string, bool) {
-	lookup, ok := lintCache[key]
-	return lookup, ok
+	entry, ok := lintCache[key]
+	if !ok || time.Since(entry.Stored) > LINT_CACHE_TTL {
+		return "", false
+	}
+	return entry.Value, true
 }
 
 func GetLintCacheB(key string) ([]byte, bool) {
-	lookup, ok := lintCache[key]
+	lookup, ok := GetLintCache(key)
 	return []byte(lookup), ok
 }
 
 func GetLintCacheI(key string) (int, bool) {
-	lookup, ok := lintCache[key]
+	lookup, ok := GetLintCache(key)
 
 	if !ok {
 		return 0, false
@@ -52,40 +70,34 @@ func SetLintCache(key string, value any) {
 	if err != nil {
 		panic(err)
 	}
-	lintCache[key] = string(stringValue)
+	SetLintCacheS(key, string(stringValue))
 }
 
 func SetLintCacheS(key string, value string) {
-	lintCache[key] = value
+	lintCache[key] = lintCacheEntry{Value: value, Stored: time.Now()}
 }
 
 func SetLintCacheI(key string, value int) {
-	stringValue := strconv.Itoa(value)
-	lintCache[key] = stringValue
+	SetLintCacheS(key, strconv.Itoa(value))
 }
 
-type IncludeEntry struct {
-	Project string `yaml:"project"`
-	Local   string `yaml:"local"`
-	File    string `yaml:"file"`
-}
-
-func (i *IncludeEntry) UnmarshalYAML(unmarshal func(interface{}) error) error {
-	var str string
-	if err := unmarshal(&str); err == nil {
-		i.Local = str
-		return nil
+// lintCacheFile is only readable by the user: it holds files of private
+// projects.
+func lintCacheFile() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
 	}
-	type rawIncludeEntry IncludeEntry
-	return unmarshal((*rawIncludeEntry)(i))
-}
-
-type IncludeStageFile struct {
-	Include []IncludeEntry `yaml:"include"`
+	return filepath.Join(dir, "credder", "lint-cache.json"), nil
 }
 
 func loadCache() error {
-	bytes, err := os.ReadFile("/tmp/credder-lint-cache")
+	path, err := lintCacheFile()
+	if err != nil {
+		// Without a cache directory, nothing is cached between runs.
+		return nil
+	}
+	bytes, err := os.ReadFile(path)
 	if err == nil {
 		err := json.Unmarshal(bytes, &lintCache)
 		if err != nil {
@@ -96,66 +108,123 @@ func loadCache() error {
 	return nil
 }
 
-func getContentFromIncludes(yamlString string) (string, error) {
-	var t IncludeStageFile
-	err := yaml.Unmarshal([]byte(yamlString), &t)
-	if err != nil {
-		return "", fmt.Errorf("error unmarshalling yaml: %w", err)
-	}
-	allContent := yamlString
-	for _, include := range t.Include {
-		if include.Project != "" {
-			project_id, err := GetProjectIdFromPath(include.Project)
-			if err != nil {
-				return "", fmt.Errorf("error getting project id from path: %w", err)
-			}
-			content, err := GetFileFromProjectIdAndPath(project_id, include.File)
-			if err != nil {
-				return "", fmt.Errorf("error getting file from project id and path: %w", err)
-			}
-			includeContent, err := getContentFromIncludes(content)
-			if err != nil {
-				return "", fmt.Errorf("error getting content from includes: %w", err)
-			}
-			allContent = allContent + "\n" + includeContent
-		} else if include.Local != "" {
-			wd, _ := os.Getwd()
-			content, err := os.ReadFile(wd + include.Local)
-			if err != nil {
-				return "", fmt.Errorf("error reading file: %w", err)
-			}
-			includeContent, err := getContentFromIncludes(string(content))
-			if err != nil {
-				return "", fmt.Errorf("error getting content from includes: %w", err)
-			}
-
-			allContent = allContent + "\n" + includeContent
-
+// Write the lint cache, without expired entries.
+func saveCache() {
+	path, err := lintCacheFile()
+	if err != nil {
+		return
+	}
+	for key, entry := range lintCache {
+		if time.Since(entry.Stored) > LINT_CACHE_TTL {
+			delete(lintCache, key)
 		}
 	}
-	return allContent, nil
+	bytes, _ := json.Marshal(lintCache)
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err == nil {
+		err = os.WriteFile(path, bytes, 0600)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "warning: could not save lint cache:", err)
+	}
 }
 
-// recusively get all includes
-// lint
-// repeat for possible trigger pipelines
-func pass1(path string, configuration string) error {
-	data, err := os.ReadFile(path)
+// Downstream pipelines nested deeper than this are not linted.
+var MAX_TRIGGER_DEPTH = 10
+
+// lintTarget is a configuration to lint: the main one, a child pipeline, or
+// the pipeline of another project.
+type lintTarget struct {
+	Name    string
+	Source  IncludeSource
+	Content string
+	// ProjectID is the project to lint in; 0 for the project of the checkout.
+	ProjectID int
+	// Inherited are the variables an upstream pipeline passes down.
+	Inherited []string
+}
+
+// readCiConfig reads the pipeline configuration of the checkout's project
+// and returns its path and content.
+func readCiConfig() (string, string, error) {
+	projectId, err := GetProjectID()
+	if err != nil {
+		return "", "", err
+	}
+	ciConfigPath, err := GetCiConfigPath(projectId)
+	if err != nil {
+		return "", "", fmt.Errorf("error getting CI config path: %w", err)
+	}
+	// The CI config path is relative to the top level of the checkout.
+	root, err := GetGitTopLevel()
+	if err != nil {
+		return "", "", err
+	}
+	data, err := os.ReadFile(filepath.Join(root, ciConfigPath))
+	if err != nil {
+		return "", "", fmt.Errorf("error reading file: %w", err)
+	}
+	return ciConfigPath, string(data), nil
+}
+
+// getContentFromIncludes returns the configuration merged with all files it
+// includes, see include.go and merge.go
+func getContentFromIncludes(path string, yamlString string) (string, error) {
+	return mergeWithIncludes(IncludeSource{Kind: "local", Path: path}, yamlString)
+}
+
+// mergeWithIncludes merges a configuration with its includes, as for a
+// pipeline of the checked out branch.
+func mergeWithIncludes(source IncludeSource, yamlString string) (string, error) {
+	return mergeWithVariables(source, yamlString, checkoutVariables(yamlString))
+}
+
+// checkoutVariables are the variables rules:if of includes see in a
+// pipeline of the checked out branch.
+func checkoutVariables(yamlString string) map[string]string {
+	// The variables file is optional here; it only feeds rules:if.
+	local := ProjectSecrets{}
+	if _, err := os.Stat(DEFAULT_FILE_NAME); err == nil {
+		local.Read(DEFAULT_FILE_NAME)
+	}
+	return PipelineVariables(yamlString, local)
+}
+
+// mergeWithVariables merges a configuration with the includes whose rules
+// match the pipeline variables.
+func mergeWithVariables(source IncludeSource, yamlString string, variables map[string]string) (string, error) {
+	root, err := GetGitTopLevel()
 	if err != nil {
-		return fmt.Errorf("error reading file: %w", err)
+		return "", err
 	}
+	resolver := NewIncludeResolver(root, variables)
+	err = resolver.ResolveConfigAt(source, yamlString)
+	if err != nil {
+		return "", err
+	}
+	return MergeConfig(yamlString, resolver.Files)
+}
 
-	content, err := getContentFromIncludes(string(data))
+// recusively get all includes
+// lint
+// returns the merged configuration for pass 2 and the trigger pipelines
+func pass1(target lintTarget) (string, error) {
+	content, err := mergeWithIncludes(target.Source, target.Content)
 	if err != nil {
-		return fmt.Errorf("error getting content from includes: %w", err)
+		return "", fmt.Errorf("error getting content from includes: %w", err)
 	}
 
-	lintResult, err := LintCiFromString(content)
+	var lintResult gitlab.ProjectLintResult
+	if target.ProjectID != 0 {
+		lintResult, err = LintCiForProject(target.ProjectID, content)
+	} else {
+		lintResult, err = LintCiFromString(content)
+	}
 	if err != nil {
-		return fmt.Errorf("error linting ci from string: %w", err)
+		return "", fmt.Errorf("error linting ci from string: %w", err)
 	}
 
-	fmt.Printf("=============== %s =================\n", configuration)
+	fmt.Printf("=============== %s =================\n", target.Name)
 	if lintResult.Valid {
 		fmt.Println("Valid :)")
 	} else {
@@ -164,32 +233,172 @@ func pass1(path string, configuration string) error {
 			fmt.Println("=>", e)
 		}
 	}
+	return content, nil
+}
 
-	// Get trigger pipelines
+// check the variables used by the jobs
+func pass2(mergedYaml string, inherited []string) error {
+	local := ProjectSecrets{}
+	err := local.Read(DEFAULT_FILE_NAME)
+	if err != nil {
+		fmt.Println("Skipping variable check, could not load local variables file:", err)
+		return nil
+	}
+
+	problems, err := CheckVariableReferences(mergedYaml, local, inherited)
+	if err != nil {
+		return fmt.Errorf("error checking variables: %w", err)
+	}
+	if len(problems) == 0 {
+		fmt.Println("Variables valid :)")
+		return nil
+	}
+	fmt.Println("Variables: ")
+	for _, problem := range problems {
+		fmt.Println("=>", problem)
+	}
 	return nil
 }
 
-func Lint() error {
+// triggerTarget finds the configuration of a downstream pipeline. A child
+// pipeline runs in the project of its parent, and its local includes are
+// relative to that project.
+func triggerTarget(parent lintTarget, trigger TriggeredPipeline) (lintTarget, error) {
+	if trigger.Project == "" {
+		content, err := yaml.Marshal(map[string]any{"include": trigger.Include})
+		if err != nil {
+			return lintTarget{}, err
+		}
+		source := parent.Source
+		source.Kind, source.Path = "trigger", trigger.Job
+		return lintTarget{
+			Name:      fmt.Sprintf("%s > %s (child pipeline)", parent.Name, trigger.Job),
+			Source:    source,
+			Content:   string(content),
+			ProjectID: parent.ProjectID,
+			Inherited: append(append([]string{}, trigger.Variables...), parent.Inherited...),
+		}, nil
+	}
+
+	projectId, err := GetProjectIdFromPath(trigger.Project)
+	if err != nil {
+		return lintTarget{}, err
+	}
+	branch := trigger.Branch
+	if branch == "" {
+		branch, err = GetDefaultBranch(projectId)
+		if err != nil {
+			return lintTarget{}, err
+		}
+	}
+	path, err := GetCiConfigPath(projectId)
+	if err != nil {
+		return lintTarget{}, fmt.Errorf("error getting CI config path of %s: %w", trigger.Project, err)
+	}
+	content, err := GetFileFromProjectIdAndPath(projectId, path, branch)
+	if err != nil {
+		return lintTarget{}, fmt.Errorf("error getting %s of %s: %w", path, trigger.Project, err)
+	}
+	return lintTarget{
+		Name:      fmt.Sprintf("%s > %s (%s@%s)", parent.Name, trigger.Job, trigger.Project, branch),
+		Source:    IncludeSource{Kind: "project", ProjectID: projectId, Project: trigger.Project, Ref: branch, Path: path},
+		Content:   content,
+		ProjectID: projectId,
+	}, nil
+}
+
+// lintPipeline lints a configuration and then, recursively, the pipelines
+// its trigger jobs start. Every configuration is linted once.
+func lintPipeline(target lintTarget, seen map[string]bool, depth int) error {
+	mergedYaml, err := pass1(target)
+	if err != nil {
+		return fmt.Errorf("error in pass 1 of %s: %w", target.Name, err)
+	}
+
+	// The variables file belongs to the checkout's project.
+	if target.ProjectID == 0 {
+		err = pass2(mergedYaml, target.Inherited)
+		if err != nil {
+			return fmt.Errorf("error in pass 2 of %s: %w", target.Name, err)
+		}
+	}
+
+	// GitLab's lint reports invalid configurations; without trigger jobs
+	// there is just nothing more to lint.
+	triggers, err := TriggeredPipelines(mergedYaml)
+	if err != nil {
+		fmt.Println("Not following trigger jobs:", err)
+		return nil
+	}
+	for _, trigger := range triggers {
+		if trigger.Generated != "" {
+			fmt.Printf("=============== %s > %s (child pipeline) =================\n", target.Name, trigger.Job)
+			fmt.Printf("Skipped: the configuration is an artifact of job %s\n", trigger.Generated)
+			continue
+		}
+		// A downstream pipeline that cannot be found is reported in its
+		// own block; the other pipelines are still linted.
+		child, err := triggerTarget(target, trigger)
+		if err != nil {
+			fmt.Printf("=============== %s > %s =================\n", target.Name, trigger.Job)
+			fmt.Println("Could not get the pipeline of the trigger job:", err)
+			continue
+		}
+		key := child.Source.String() + "\n" + child.Content
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if depth >= MAX_TRIGGER_DEPTH {
+			fmt.Printf("=============== %s =================\n", child.Name)
+			fmt.Printf("Skipped: downstream pipelines are nested deeper than %d levels\n", MAX_TRIGGER_DEPTH)
+			continue
+		}
+		err = lintPipeline(child, seen, depth+1)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Lint lints the pipeline configuration; with dryRun it then simulates the
+// pipeline for the refs (at most two, compared side by side).
+func Lint(dryRun bool, refs []string) error {
+	if len(refs) > 0 && !dryRun {
+		return fmt.Errorf("--ref only applies to --dry-run")
+	}
+	if len(refs) > 2 {
+		return fmt.Errorf("can compare two refs at most, got %d", len(refs))
+	}
+
 	err := loadCache()
 	if err != nil {
 		return fmt.Errorf("error loading cache: %w", err)
 	}
 
-	projectId := GetProjectID()
-	ciConfigPath, err := GetCiConfigPath(projectId)
+	ciConfigPath, data, err := readCiConfig()
 	if err != nil {
-		return fmt.Errorf("error getting CI config path: %w", err)
+		return err
 	}
 
-	err = pass1(ciConfigPath, "Main configuration")
+	main := lintTarget{
+		Name:    "Main configuration",
+		Source:  IncludeSource{Kind: "local", Path: ciConfigPath},
+		Content: data,
+	}
+	err = lintPipeline(main, map[string]bool{}, 0)
 	if err != nil {
-		return fmt.Errorf("error in pass 1: %w", err)
+		return err
 	}
 
-	// Write lint cache to /tmp/credder-lint-cache
-	var bytes []byte
-	bytes, _ = json.Marshal(lintCache)
-	os.WriteFile("/tmp/credder-lint-cache", bytes, 0644)
+	if dryRun {
+		err = DryRun(ciConfigPath, data, refs)
+		if err != nil {
+			return err
+		}
+	}
 
+	saveCache()
 	return nil
 }
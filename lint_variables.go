@@ -0,0 +1,362 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Pass 2 of linting: every $VAR or ${VAR} used in a job must be predefined,
+// set in the YAML, set by the job's script, or be in the variables file for
+// the job's environment scope.
+
+// ReferenceProblem is a variable reference that nothing defines.
+type ReferenceProblem struct {
+	Job      string
+	Where    string
+	Variable string
+	Message  string
+}
+
+func (problem ReferenceProblem) String() string {
+	return fmt.Sprintf("%s (%s): $%s %s", problem.Job, problem.Where, problem.Variable, problem.Message)
+}
+
+// Top level keywords that are not jobs.
+var ciKeywords = map[string]bool{
+	"default": true, "include": true, "stages": true, "variables": true, "workflow": true,
+	"image": true, "services": true, "cache": true, "before_script": true, "after_script": true,
+	"spec": true,
+}
+
+var (
+	// $$ is an escaped dollar; ${VAR...} may carry a shell modifier.
+	variableReference = regexp.MustCompile(`\$(\$|\{([A-Za-z_][A-Za-z0-9_]*)([^}]*)\}|[A-Za-z_][A-Za-z0-9_]*)`)
+	shellAssignment   = regexp.MustCompile(`(?:^|[\s;&|(])([A-Za-z_][A-Za-z0-9_]*)=`)
+	shellLoopVariable = regexp.MustCompile(`\b(?:for|select)\s+([A-Za-z_][A-Za-z0-9_]*)\s+in\b`)
+	shellRead         = regexp.MustCompile(`\bread((?:\s+-\w+)*(?:\s+[A-Za-z_][A-Za-z0-9_]*)+)`)
+)
+
+// variableReferences returns the variables a text uses. Variables with a
+// default (${VAR:-default}) are optional and skipped. In shell scripts,
+// single quoted text is not expanded.
+func variableReferences(text string, shell bool) []string {
+	if shell {
+		text = stripSingleQuoted(text)
+	}
+	names := []string{}
+	for _, match := range variableReference.FindAllStringSubmatchIndex(text, -1) {
+		reference := text[match[2]:match[3]]
+		switch {
+		case reference == "$":
+			continue
+		case match[4] >= 0:
+			modifier := text[match[6]:match[7]]
+			optional := false
+			for _, prefix := range []string{"-", ":-", "=", ":=", "+", ":+"} {
+				optional = optional || strings.HasPrefix(modifier, prefix)
+			}
+			if !optional {
+				names = append(names, text[match[4]:match[5]])
+			}
+		case match[1] < len(text) && text[match[1]] == ':':
+			// PowerShell's $env:NAME
+			continue
+		default:
+			names = append(names, reference)
+		}
+	}
+	return names
+}
+
+func stripSingleQuoted(text string) string {
+	var builder strings.Builder
+	inSingle, inDouble := false, false
+	for _, char := range text {
+		switch {
+		case char == '\'' && !inDouble:
+			inSingle = !inSingle
+			continue
+		case char == '"' && !inSingle:
+			inDouble = !inDouble
+		}
+		if !inSingle {
+			builder.WriteRune(char)
+		}
+	}
+	return builder.String()
+}
+
+// shellDefinitions returns the variables a script sets itself.
+func shellDefinitions(script string) []string {
+	names := []string{}
+	for _, match := range shellAssignment.FindAllStringSubmatch(script, -1) {
+		names = append(names, match[1])
+	}
+	for _, match := range shellLoopVariable.FindAllStringSubmatch(script, -1) {
+		names = append(names, match[1])
+	}
+	for _, match := range shellRead.FindAllStringSubmatch(script, -1) {
+		for _, field := range strings.Fields(match[1]) {
+			if !strings.HasPrefix(field, "-") {
+				names = append(names, field)
+			}
+		}
+	}
+	return names
+}
+
+// yamlMap converts a decoded YAML mapping to a map with string keys.
+func yamlMap(value any) (map[string]any, bool) {
+	switch typed := value.(type) {
+	case map[string]any:
+		return typed, true
+	case map[any]any:
+		converted := make(map[string]any, len(typed))
+		for key, item := range typed {
+			converted[fmt.Sprint(key)] = item
+		}
+		return converted, true
+	}
+	return nil, false
+}
+
+// yamlStrings flattens a string or a (nested) list of strings, like script
+// sections with !reference.
+func yamlStrings(value any) []string {
+	switch typed := value.(type) {
+	case nil:
+		return nil
+	case []any:
+		strs := []string{}
+		for _, item := range typed {
+			strs = append(strs, yamlStrings(item)...)
+		}
+		return strs
+	case map[any]any, map[string]any:
+		return nil
+	}
+	return []string{fmt.Sprint(value)}
+}
+
+// variableNames returns the keys of a variables: block.
+func variableNames(value any) []string {
+	block, _ := yamlMap(value)
+	names := []string{}
+	for name := range block {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// variableValues returns the values of a variables: block, which are
+// strings or hashes with a value.
+func variableValues(value any) map[string]string {
+	block, _ := yamlMap(value)
+	values := make(map[string]string)
+	for name, item := range block {
+		if detailed, ok := yamlMap(item); ok {
+			item = detailed["value"]
+		}
+		if item != nil {
+			values[name] = fmt.Sprint(item)
+		}
+	}
+	return values
+}
+
+// ciText is a piece of a job that may use variables.
+type ciText struct {
+	Where string
+	Text  string
+	Shell bool
+}
+
+func rulesTexts(rules any, where string) ([]ciText, []string) {
+	texts := []ciText{}
+	defined := []string{}
+	list, _ := rules.([]any)
+	for _, item := range list {
+		rule, ok := yamlMap(item)
+		if !ok {
+			continue
+		}
+		if condition, ok := rule["if"].(string); ok {
+			texts = append(texts, ciText{Where: where, Text: condition})
+		}
+		values := variableValues(rule["variables"])
+		for _, name := range variableNames(rule["variables"]) {
+			texts = append(texts, ciText{Where: where, Text: values[name]})
+			defined = append(defined, name)
+		}
+	}
+	return texts, defined
+}
+
+// environmentPattern turns a job's environment name into a scope pattern,
+// treating variables in it as wildcards.
+func environmentPattern(job map[string]any) string {
+	name := ""
+	switch environment := job["environment"].(type) {
+	case string:
+		name = environment
+	default:
+		if detailed, ok := yamlMap(environment); ok {
+			name, _ = detailed["name"].(string)
+		}
+	}
+	return variableReference.ReplaceAllString(name, "*")
+}
+
+// CheckVariableReferences checks the variables used by the jobs of a merged
+// CI configuration against the YAML and the variables file. Jobs are checked
+// as expanded, with extends and !reference applied. Inherited variables come
+// from an upstream pipeline.
+func CheckVariableReferences(config string, variables ProjectSecrets, inherited []string) ([]ReferenceProblem, error) {
+	expanded, err := expandConfigNode(config, "")
+	if err != nil {
+		return nil, err
+	}
+	root := map[string]any{}
+	err = expanded.Decode(&root)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding expanded yaml: %w", err)
+	}
+
+	scopes := make(map[string][]string)
+	for _, secret := range variables.Variables {
+		scopes[secret.Key] = append(scopes[secret.Key], secret.Environment)
+	}
+
+	globalDefined := append(variableNames(root["variables"]), inherited...)
+	globalTexts := []ciText{}
+	globalValues := variableValues(root["variables"])
+	for _, name := range globalDefined {
+		globalTexts = append(globalTexts, ciText{Where: "variables", Text: globalValues[name]})
+	}
+	if workflow, ok := yamlMap(root["workflow"]); ok {
+		texts, defined := rulesTexts(workflow["rules"], "workflow:rules")
+		globalTexts = append(globalTexts, texts...)
+		globalDefined = append(globalDefined, defined...)
+	}
+
+	defaults, _ := yamlMap(root["default"])
+	if defaults == nil {
+		defaults = map[string]any{}
+	}
+	for _, key := range []string{"before_script", "after_script"} {
+		if _, found := defaults[key]; !found && root[key] != nil {
+			defaults[key] = root[key]
+		}
+	}
+
+	dotenvJobs := []string{}
+	names := []string{}
+	jobs := make(map[string]map[string]any)
+	for name := range root {
+		if job, ok := yamlMap(root[name]); ok && !ciKeywords[name] {
+			names = append(names, name)
+			jobs[name] = job
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		job := jobs[name]
+		if artifacts, ok := yamlMap(job["artifacts"]); ok {
+			if reports, ok := yamlMap(artifacts["reports"]); ok && reports["dotenv"] != nil {
+				dotenvJobs = append(dotenvJobs, name)
+			}
+		}
+	}
+
+	problems := []ReferenceProblem{}
+	seen := make(map[ReferenceProblem]bool)
+	check := func(job string, pattern string, defined map[string]bool, texts []ciText) {
+		for _, text := range texts {
+			for _, name := range variableReferences(text.Text, text.Shell) {
+				if defined[name] || IsPredefinedVariable(name) {
+					continue
+				}
+				problem := ReferenceProblem{Job: job, Where: text.Where, Variable: name}
+				matching := []string{}
+				for _, scope := range scopes[name] {
+					if scopesOverlap(scope, pattern) {
+						matching = append(matching, scope)
+					}
+				}
+				switch {
+				case len(matching) > 0:
+					continue
+				case len(scopes[name]) > 0 && pattern == "":
+					problem.Message = fmt.Sprintf("is only in %s for scope(s) %s, and the job has no environment",
+						DEFAULT_FILE_NAME, strings.Join(scopes[name], ", "))
+				case len(scopes[name]) > 0:
+					problem.Message = fmt.Sprintf("is only in %s for scope(s) %s, not for the job's environment %s",
+						DEFAULT_FILE_NAME, strings.Join(scopes[name], ", "), pattern)
+				default:
+					problem.Message = fmt.Sprintf("is not predefined, not set in the YAML and not in %s", DEFAULT_FILE_NAME)
+					if len(dotenvJobs) > 0 {
+						problem.Message += fmt.Sprintf(" (unless a dotenv report of %s sets it)", strings.Join(dotenvJobs, ", "))
+					}
+				}
+				if !seen[problem] {
+					seen[problem] = true
+					problems = append(problems, problem)
+				}
+			}
+		}
+	}
+
+	defined := make(map[string]bool)
+	for _, name := range globalDefined {
+		defined[name] = true
+	}
+	// Global variables are expanded in every job, so any scope will do.
+	check("(global)", "*", defined, globalTexts)
+
+	for _, name := range names {
+		job := jobs[name]
+		for _, key := range []string{"before_script", "after_script"} {
+			if _, found := job[key]; !found && defaults[key] != nil {
+				job[key] = defaults[key]
+			}
+		}
+
+		defined := make(map[string]bool)
+		for _, variable := range globalDefined {
+			defined[variable] = true
+		}
+		texts := []ciText{}
+		values := variableValues(job["variables"])
+		for _, variable := range variableNames(job["variables"]) {
+			defined[variable] = true
+			texts = append(texts, ciText{Where: "variables", Text: values[variable]})
+		}
+		ruleTexts, ruleDefined := rulesTexts(job["rules"], "rules")
+		texts = append(texts, ruleTexts...)
+		for _, variable := range ruleDefined {
+			defined[variable] = true
+		}
+		if parallel, ok := yamlMap(job["parallel"]); ok {
+			matrix, _ := parallel["matrix"].([]any)
+			for _, entry := range matrix {
+				for _, variable := range variableNames(entry) {
+					defined[variable] = true
+				}
+			}
+		}
+		for _, key := range []string{"before_script", "script", "after_script"} {
+			for _, line := range yamlStrings(job[key]) {
+				texts = append(texts, ciText{Where: key, Text: line, Shell: true})
+				for _, variable := range shellDefinitions(stripSingleQuoted(line)) {
+					defined[variable] = true
+				}
+			}
+		}
+		check(name, environmentPattern(job), defined, texts)
+	}
+	return problems, nil
+}
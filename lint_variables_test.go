@@ -0,0 +1,79 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVariableReferences(t *testing.T) {
+	tests := []struct {
+		text  string
+		shell bool
+		want  []string
+	}{
+		{`echo $FOO ${BAR}`, true, []string{"FOO", "BAR"}},
+		{`echo $$ESCAPED ${OPTIONAL:-default} ${REQUIRED%.txt}`, true, []string{"REQUIRED"}},
+		{`awk '{print $NF}' "$FILE"`, true, []string{"FILE"}},
+		{`echo "it's $NAME"`, true, []string{"NAME"}},
+		{`$CI_COMMIT_BRANCH == "main" && $DEPLOY`, false, []string{"CI_COMMIT_BRANCH", "DEPLOY"}},
+		{`Write-Host $env:TOKEN`, true, []string{}},
+	}
+	for _, test := range tests {
+		if got := variableReferences(test.text, test.shell); !reflect.DeepEqual(got, test.want) {
+			t.Errorf(`variableReferences(%q) = %q, want %q`, test.text, got, test.want)
+		}
+	}
+}
+
+func TestCheckVariableReferences(t *testing.T) {
+	config := `
+variables:
+  GLOBAL: "$GLOBAL_SECRET"
+.deploy:
+  variables:
+    TEMPLATE: "1"
+  script:
+    - export RELEASE=$CI_COMMIT_SHORT_SHA
+    - deploy $RELEASE $TEMPLATE $GLOBAL $TOKEN
+review:
+  extends: .deploy
+  environment:
+    name: review/$CI_COMMIT_REF_SLUG
+  rules:
+    - if: $REVIEW_ENABLED
+production:
+  extends: .deploy
+  environment: production
+test:
+  script:
+    - for f in *.go; do echo $f $TOKEN $TYPO; done
+.setup:
+  script:
+    - setup $SETUP_TOKEN
+referenced:
+  script:
+    - !reference [.setup, script]
+`
+	variables := ProjectSecrets{Variables: []Secret{
+		{Key: "GLOBAL_SECRET", Environment: "*"},
+		{Key: "REVIEW_ENABLED", Environment: "*"},
+		{Key: "TOKEN", Environment: "production"},
+		{Key: "TOKEN", Environment: "review/*"},
+	}}
+	problems, err := CheckVariableReferences(config, variables, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := []string{}
+	for _, problem := range problems {
+		messages = append(messages, problem.String())
+	}
+	want := []string{
+		"referenced (script): $SETUP_TOKEN is not predefined, not set in the YAML and not in gitlab_variables.json",
+		"test (script): $TOKEN is only in gitlab_variables.json for scope(s) production, review/*, and the job has no environment",
+		"test (script): $TYPO is not predefined, not set in the YAML and not in gitlab_variables.json",
+	}
+	if !reflect.DeepEqual(messages, want) {
+		t.Errorf(`CheckVariableReferences() = %q, want %q`, messages, want)
+	}
+}
@@ -11,6 +11,44 @@ import (
 
 var DEFAULT_FILE_NAME = "gitlab_variables.json"
 
+var contextFlag = &cli.IntFlag{
+	Name:    "context",
+	Aliases: []string{"U"},
+	Value:   8,
+	Usage:   "Number of unchanged lines to show around changes in diffs.",
+}
+
+var showSecretsFlag = &cli.BoolFlag{
+	Name:  "show-secrets",
+	Usage: "Show variable values in diffs and prompts instead of fingerprints.",
+}
+
+var groupFlag = &cli.StringFlag{
+	Name:  "group",
+	Usage: "Work with the variables of this group (ID or full path) instead of the current project.",
+}
+
+var instanceFlag = &cli.BoolFlag{
+	Name:  "instance",
+	Usage: "Work with the instance-level variables (requires administrator access).",
+}
+
+// targetFromFlags returns the instance when --instance is given, the group
+// given by --group, or the project of the current git repository.
+func targetFromFlags(cmd *cli.Command) (Target, error) {
+	if cmd.Bool("instance") {
+		return Target{Instance: true}, nil
+	}
+	if group := cmd.String("group"); group != "" {
+		return Target{GroupID: group}, nil
+	}
+	projectId, err := GetProjectID()
+	if err != nil {
+		return Target{}, err
+	}
+	return Target{ProjectID: projectId}, nil
+}
+
 func main() {
 	cli.VersionPrinter = func(cmd *cli.Command) {
 		fmt.Fprintf(cmd.Root().Writer, "%s\n", cmd.Root().Version)
@@ -25,7 +63,7 @@ func main() {
 				Name:    "file",
 				Aliases: []string{"f"},
 				Value:   DEFAULT_FILE_NAME,
-				Usage:   "Path to the variables file.",
+				Usage:   "Path to the variables file; .json, .yaml or .toml.",
 			},
 			&cli.StringFlag{
 				Name:     "gitlab-token",
@@ -35,6 +73,34 @@ func main() {
 				Sources:  cli.EnvVars("GL_PAT", "GITLAB_TOKEN"),
 				Required: true,
 			},
+			&cli.StringFlag{
+				Name:    "gitlab-url",
+				Aliases: []string{"u"},
+				Value:   "",
+				Usage:   "Base URL of the GitLab instance; defaults to the variables file setting, then the host of the origin remote.",
+				Sources: cli.EnvVars("GITLAB_URL", "CI_SERVER_URL"),
+			},
+			&cli.StringFlag{
+				Name:  "remote",
+				Value: "origin",
+				Usage: "Git remote used to find the project and GitLab instance.",
+			},
+			&cli.StringFlag{
+				Name:  "color",
+				Value: "auto",
+				Usage: "Colour diffs: auto (when writing to a terminal), always or never.",
+			},
+		},
+		Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+			DEFAULT_FILE_NAME = cmd.String("file")
+			gitlabURL = cmd.String("gitlab-url")
+			gitRemoteName = cmd.String("remote")
+			color, err := ColorEnabled(cmd.String("color"))
+			if err != nil {
+				return ctx, err
+			}
+			diffOptions.Color = color
+			return ctx, nil
 		},
 		EnableShellCompletion: true,
 		Commands: []*cli.Command{
@@ -42,18 +108,50 @@ func main() {
 				Name:    "init",
 				Aliases: []string{},
 				Usage:   "Set up a new variable file.",
+				Flags:   []cli.Flag{groupFlag, instanceFlag},
 				Action: func(ctx context.Context, cmd *cli.Command) error {
-					project_id := GetProjectID()
-					init_variables(project_id)
+					target, err := targetFromFlags(cmd)
+					if err != nil {
+						return err
+					}
+					init_variables(target)
 					return nil
 				},
 			},
 			{
 				Name:    "import",
 				Aliases: []string{},
-				Usage:   "Overwrite local variables with remote.",
+				Usage:   "Overwrite local variables with remote, or merge a .env file with --from.",
+				Flags: []cli.Flag{
+					groupFlag,
+					instanceFlag,
+					&cli.StringFlag{
+						Name:  "from",
+						Usage: "Merge the entries of this .env file into the variables file instead.",
+					},
+					&cli.StringFlag{
+						Name:  "env",
+						Value: "*",
+						Usage: "Environment scope for variables merged from a .env file.",
+					},
+					&cli.StringFlag{
+						Name:  "op-vault",
+						Usage: "Store .env values in this 1Password vault and reference them.",
+					},
+					&cli.StringFlag{
+						Name:  "op-item",
+						Usage: "Name of the new 1Password item that holds the .env values.",
+					},
+				},
 				Action: func(ctx context.Context, cmd *cli.Command) error {
-					Import()
+					if from := cmd.String("from"); from != "" {
+						return ImportDotenv(from, cmd.String("env"), cmd.String("op-vault"), cmd.String("op-item"))
+					}
+					target, err := targetFromFlags(cmd)
+					if err != nil {
+						return err
+					}
+					Import(target)
 					return nil
 				},
 			},
@@ -70,20 +168,154 @@ func main() {
 				Name:    "push",
 				Aliases: []string{},
 				Usage:   "Update remote variables with local.",
+				Flags: []cli.Flag{
+					contextFlag,
+					showSecretsFlag,
+					&cli.StringFlag{
+						Name:  "plan",
+						Usage: "Apply a plan saved with 'diff --out'; refuses when the variables changed since.",
+					},
+					&cli.BoolFlag{
+						Name:  "auto-approve",
+						Usage: "Apply all changes without prompting.",
+					},
+					&cli.BoolFlag{
+						Name:  "approve-create",
+						Usage: "Create variables without prompting; other changes are skipped unless approved.",
+					},
+					&cli.BoolFlag{
+						Name:  "approve-update",
+						Usage: "Update variables without prompting; other changes are skipped unless approved.",
+					},
+					&cli.BoolFlag{
+						Name:  "approve-delete",
+						Usage: "Delete variables without prompting; other changes are skipped unless approved.",
+					},
+					&cli.BoolFlag{
+						Name:  "no-delete",
+						Usage: "Never delete remote variables.",
+					},
+					&cli.StringFlag{
+						Name:  "summary",
+						Usage: "Write a JSON summary of the push to this file, or - for stdout (other output then goes to stderr).",
+					},
+				},
 				Action: func(ctx context.Context, cmd *cli.Command) error {
-					Push()
-					return nil
+					diffOptions.Context = int(cmd.Int("context"))
+					showSecrets = cmd.Bool("show-secrets")
+					autoApprove := cmd.Bool("auto-approve")
+					return Push(PushOptions{
+						PlanFile:      cmd.String("plan"),
+						ApproveCreate: autoApprove || cmd.Bool("approve-create"),
+						ApproveUpdate: autoApprove || cmd.Bool("approve-update"),
+						ApproveDelete: autoApprove || cmd.Bool("approve-delete"),
+						NoDelete:      cmd.Bool("no-delete"),
+						SummaryFile:   cmd.String("summary"),
+					})
 				},
 			},
 			{
 				Name:    "diff",
 				Aliases: []string{},
 				Usage:   "Show staged local changes (what will change on GitLab).",
+				Flags: []cli.Flag{
+					contextFlag,
+					showSecretsFlag,
+					&cli.StringFlag{
+						Name:  "out",
+						Usage: "Save the changes as a plan, to apply with 'push --plan'.",
+					},
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Value:   "text",
+						Usage:   "Output format: text, json or markdown.",
+					},
+				},
 				Action: func(ctx context.Context, cmd *cli.Command) error {
-					Diff()
+					output := cmd.String("output")
+					if output != "text" && output != "json" && output != "markdown" {
+						return fmt.Errorf("invalid output format %s; use text, json or markdown", output)
+					}
+					diffOptions.Context = int(cmd.Int("context"))
+					showSecrets = cmd.Bool("show-secrets")
+					Diff(cmd.String("out"), output)
 					return nil
 				},
 			},
+			{
+				Name:    "export",
+				Aliases: []string{},
+				Usage:   "Write the variables of an environment, with secrets resolved, to a .env file.",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "env",
+						Usage:    "Environment name to export the variables of.",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Value: "dotenv",
+						Usage: "Output format; only dotenv is supported.",
+					},
+					&cli.StringFlag{
+						Name:    "out",
+						Aliases: []string{"o"},
+						Usage:   "File to write to; defaults to stdout.",
+					},
+					&cli.StringFlag{
+						Name:  "files-dir",
+						Value: ".credder-files",
+						Usage: "Directory to write the content of file variables to; their path is exported, as in CI.",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return Export(cmd.String("env"), cmd.String("format"), cmd.String("out"), cmd.String("files-dir"))
+				},
+			},
+			{
+				Name:    "resolve",
+				Aliases: []string{},
+				Usage:   "Show which variable definition GitLab uses for each key in an environment.",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "env",
+						Usage:    "Environment name to resolve the variables for.",
+						Required: true,
+					},
+					&cli.BoolFlag{
+						Name:  "show-secrets",
+						Usage: "Also show the resolved values.",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					showSecrets = cmd.Bool("show-secrets")
+					return ResolveEnvironment(cmd.String("env"))
+				},
+			},
+			{
+				Name:      "run",
+				Aliases:   []string{},
+				Usage:     "Run a command with the variables of an environment, like a CI job would get them.",
+				ArgsUsage: "-- COMMAND [ARGS...]",
+				// The flag parser keeps going after "--", which would
+				// swallow the flags of the command to run, so the
+				// arguments are split by splitRunArgs instead.
+				SkipFlagParsing: true,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "env",
+						Usage: "Environment name to resolve the variables for.",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					environment, args, err := splitRunArgs(cmd.Args().Slice())
+					if err != nil {
+						return err
+					}
+					return Run(environment, args)
+				},
+			},
 			{
 				Name:    "format",
 				Aliases: []string{},
@@ -95,12 +327,115 @@ func main() {
 					return nil
 				},
 			},
+			{
+				Name:    "validate",
+				Aliases: []string{},
+				Usage:   "Check the local variables against GitLab's rules for keys, masking and sizes.",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return Validate()
+				},
+			},
+			{
+				Name:    "schema",
+				Aliases: []string{},
+				Usage:   "Print the JSON Schema of the variables file.",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return Schema()
+				},
+			},
+			{
+				Name:    "fingerprint-key",
+				Aliases: []string{},
+				Usage:   "Create the key for fingerprints of values in plans and diffs, unless it exists, and print its path.",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					path, err := CreateFingerprintKey()
+					if err != nil {
+						return err
+					}
+					fmt.Println(path)
+					return nil
+				},
+			},
+			{
+				Name:      "encrypt",
+				Aliases:   []string{},
+				Usage:     "Encrypt the values of a variable with age, or stdin when no key is given.",
+				ArgsUsage: "[KEY]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "env",
+						Usage: "Only encrypt the variable for this environment scope.",
+					},
+					&cli.StringSliceFlag{
+						Name:  "recipient",
+						Usage: "age recipient to encrypt for; defaults to age_recipients in the variables file.",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return Encrypt(cmd.Args().First(), cmd.String("env"), cmd.StringSlice("recipient"))
+				},
+			},
+			{
+				Name:      "decrypt",
+				Aliases:   []string{},
+				Usage:     "Decrypt the values of a variable, or stdin when no key is given.",
+				ArgsUsage: "[KEY]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "env",
+						Usage: "Only decrypt the variable for this environment scope.",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return Decrypt(cmd.Args().First(), cmd.String("env"))
+				},
+			},
+			{
+				Name:      "convert",
+				Aliases:   []string{},
+				Usage:     "Write the variables file in another format (.json, .yaml or .toml).",
+				ArgsUsage: "TARGET",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return Convert(cmd.Args().First())
+				},
+			},
+			{
+				Name:    "ci",
+				Aliases: []string{},
+				Usage:   "Inspect the CI configuration.",
+				Commands: []*cli.Command{
+					{
+						Name:    "expand",
+						Aliases: []string{},
+						Usage:   "Print the effective configuration: includes merged, extends, anchors and !reference expanded.",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "job",
+								Usage: "Only print this job.",
+							},
+						},
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							return ExpandCi(cmd.String("job"))
+						},
+					},
+				},
+			},
 			{
 				Name:    "lint",
 				Aliases: []string{},
 				Usage:   "Lint the .gitlab-ci.yml file.",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "Simulate creating a pipeline and show which jobs run in which stages.",
+					},
+					&cli.StringSliceFlag{
+						Name:  "ref",
+						Usage: "Branch or tag to simulate the pipeline for; pass twice to compare two refs.",
+					},
+				},
 				Action: func(ctx context.Context, cmd *cli.Command) error {
-					err := Lint()
+					err := Lint(cmd.Bool("dry-run"), cmd.StringSlice("ref"))
 					return err
 				},
 			},
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Merging of included files as GitLab does it: every file's anchors and
+// aliases are expanded on their own, then the files are deep merged in
+// include order, with the including file last. Hashes are merged key by
+// key; anything else, lists included, is replaced by the later value.
+// Tags such as !reference are kept; expand.go resolves them.
+
+// parseConfigNode parses one configuration file and expands its aliases.
+func parseConfigNode(content string, source string) (*yaml.Node, error) {
+	document := &yaml.Node{}
+	err := yaml.Unmarshal([]byte(content), document)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling yaml of %s: %w", source, err)
+	}
+	if document.Kind == 0 {
+		// An empty file
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, nil
+	}
+	root := expandAliases(document.Content[0])
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s is not a hash of jobs and keywords", source)
+	}
+	return root, nil
+}
+
+// expandAliases returns a copy of node with aliases replaced by what they
+// point at and << merge keys applied.
+func expandAliases(node *yaml.Node) *yaml.Node {
+	if node.Kind == yaml.AliasNode {
+		return expandAliases(node.Alias)
+	}
+	expanded := *node
+	expanded.Anchor = ""
+	expanded.Content = nil
+	if node.Kind != yaml.MappingNode {
+		for _, child := range node.Content {
+			expanded.Content = append(expanded.Content, expandAliases(child))
+		}
+		return &expanded
+	}
+
+	// Explicit keys win over merged ones; of the merged hashes, the first
+	// to set a key wins.
+	merged := []*yaml.Node{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], expandAliases(node.Content[i+1])
+		if key.Tag != "!!merge" {
+			expanded.Content = append(expanded.Content, expandAliases(key), value)
+			continue
+		}
+		sources := []*yaml.Node{value}
+		if value.Kind == yaml.SequenceNode {
+			sources = value.Content
+		}
+		for _, source := range sources {
+			for j := 0; j+1 < len(source.Content); j += 2 {
+				if mappingValue(merged, source.Content[j].Value) == nil {
+					merged = append(merged, source.Content[j], source.Content[j+1])
+				}
+			}
+		}
+	}
+	for i := 0; i+1 < len(merged); i += 2 {
+		if mappingValue(expanded.Content, merged[i].Value) == nil {
+			expanded.Content = append(expanded.Content, merged[i], merged[i+1])
+		}
+	}
+	return &expanded
+}
+
+// mappingValue finds the value of a key in the content of a mapping node.
+func mappingValue(content []*yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(content); i += 2 {
+		if content[i].Value == key {
+			return content[i+1]
+		}
+	}
+	return nil
+}
+
+// mergeNodes deep merges override into base.
+func mergeNodes(base *yaml.Node, override *yaml.Node) *yaml.Node {
+	if base == nil || base.Kind != yaml.MappingNode || override.Kind != yaml.MappingNode || override.Tag != base.Tag {
+		return override
+	}
+	merged := *base
+	merged.Content = append([]*yaml.Node{}, base.Content...)
+	for i := 0; i+1 < len(override.Content); i += 2 {
+		key, value := override.Content[i], override.Content[i+1]
+		found := false
+		for j := 0; j+1 < len(merged.Content); j += 2 {
+			if merged.Content[j].Value == key.Value {
+				merged.Content[j+1] = mergeNodes(merged.Content[j+1], value)
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged.Content = append(merged.Content, key, value)
+		}
+	}
+	return &merged
+}
+
+// MergeConfig merges the files a configuration includes and the
+// configuration itself into one configuration without include:.
+func MergeConfig(content string, included []IncludedFile) (string, error) {
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, file := range included {
+		_, body := splitSpecHeader(file.Content)
+		node, err := parseConfigNode(body, file.Source.String())
+		if err != nil {
+			return "", err
+		}
+		merged = mergeNodes(merged, node)
+	}
+	node, err := parseConfigNode(content, "the configuration")
+	if err != nil {
+		return "", err
+	}
+	merged = mergeNodes(merged, node)
+
+	withoutInclude := []*yaml.Node{}
+	for i := 0; i+1 < len(merged.Content); i += 2 {
+		if merged.Content[i].Value != "include" {
+			withoutInclude = append(withoutInclude, merged.Content[i], merged.Content[i+1])
+		}
+	}
+	merged.Content = withoutInclude
+
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	err = encoder.Encode(merged)
+	if err != nil {
+		return "", fmt.Errorf("error encoding merged yaml: %w", err)
+	}
+	return buffer.String(), nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMergeConfig(t *testing.T) {
+	included := []IncludedFile{
+		{Source: IncludeSource{Kind: "local", Path: "base.yml"}, Content: `
+variables:
+  IMAGE: alpine
+  REGION: eu
+.defaults: &defaults
+  tags: [docker]
+  retry: 1
+build:
+  <<: *defaults
+  script: [make]
+  cache:
+    key: build
+    paths: [out/]
+`},
+		{Source: IncludeSource{Kind: "local", Path: "override.yml"}, Content: `
+build:
+  cache:
+    key: override
+  script: [make all]
+`},
+	}
+	config := `
+include:
+  - local: base.yml
+  - local: override.yml
+variables:
+  IMAGE: debian
+test:
+  script:
+    - !reference [build, script]
+    - make test
+`
+	merged, err := MergeConfig(config, included)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `variables:
+  IMAGE: debian
+  REGION: eu
+.defaults:
+  tags: [docker]
+  retry: 1
+build:
+  script: [make all]
+  cache:
+    key: override
+    paths: [out/]
+  tags: [docker]
+  retry: 1
+test:
+  script:
+    - !reference [build, script]
+    - make test
+`
+	if merged != want {
+		t.Errorf("MergeConfig() =\n%s\nwant\n%s", merged, want)
+	}
+
+	if _, err := MergeConfig("- not a hash\n", nil); err == nil {
+		t.Errorf(`MergeConfig() of a list succeeded, want an error`)
+	}
+}
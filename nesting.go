@@ -1,23 +1,47 @@
 package main
 
+// flatten returns the variable that a (merged) entry describes; fields the
+// file leaves out get GitLab's defaults.
+func (secret NestedSecret) flatten(key string) Secret {
+	flat := Secret{Key: key, VariableType: "env_var", Environment: "*"}
+	if secret.Value != nil {
+		flat.Value = *secret.Value
+	}
+	if secret.Description != nil {
+		flat.Description = *secret.Description
+	}
+	if secret.VariableType != nil {
+		flat.VariableType = *secret.VariableType
+	}
+	if secret.Environment != nil {
+		flat.Environment = *secret.Environment
+	}
+	if secret.Protect != nil {
+		flat.Protect = *secret.Protect
+	}
+	if secret.Mask != nil {
+		flat.Mask = *secret.Mask
+	}
+	if secret.Raw != nil {
+		flat.Raw = *secret.Raw
+	}
+	return flat
+}
+
 func (project *NestedProjectSecrets) Unnest() ProjectSecrets {
 	unnestedProject := ProjectSecrets{
-		ProjectID: project.ProjectID,
-		Variables: []Secret{},
+		ProjectID:     project.ProjectID,
+		GroupID:       project.GroupID,
+		Instance:      project.Instance,
+		GitlabURL:     project.GitlabURL,
+		AgeRecipients: project.AgeRecipients,
+		Comments:      project.Comments,
+		Variables:     []Secret{},
 	}
 
 	for _, parent := range project.Variables {
 		if len(parent.Nested) == 0 {
-			unnestedProject.Variables = append(unnestedProject.Variables, Secret{
-				Key:          parent.Key,
-				Value:        *parent.Value,
-				Description:  *parent.Description,
-				VariableType: *parent.VariableType,
-				Environment:  *parent.Environment,
-				Protect:      *parent.Protect,
-				Mask:         *parent.Mask,
-				Raw:          *parent.Raw,
-			})
+			unnestedProject.Variables = append(unnestedProject.Variables, parent.flatten(parent.Key))
 		} else {
 			for _, nested := range parent.Nested {
 				if parent.Value != nil {
@@ -42,16 +66,7 @@ func (project *NestedProjectSecrets) Unnest() ProjectSecrets {
 					nested.Raw = parent.Raw
 				}
 
-				unnestedProject.Variables = append(unnestedProject.Variables, Secret{
-					Key:          parent.Key,
-					Value:        *nested.Value,
-					Description:  *nested.Description,
-					VariableType: *nested.VariableType,
-					Environment:  *nested.Environment,
-					Protect:      *nested.Protect,
-					Mask:         *nested.Mask,
-					Raw:          *nested.Raw,
-				})
+				unnestedProject.Variables = append(unnestedProject.Variables, nested.flatten(parent.Key))
 			}
 		}
 	}
@@ -164,8 +179,13 @@ func (project *ProjectSecrets) Nest() NestedProjectSecrets {
 		topLevelGroup = append(topLevelGroup, parentSecret)
 	}
 	nestedProject := NestedProjectSecrets{
-		ProjectID: project.ProjectID,
-		Variables: topLevelGroup,
+		ProjectID:     project.ProjectID,
+		GroupID:       project.GroupID,
+		Instance:      project.Instance,
+		GitlabURL:     project.GitlabURL,
+		AgeRecipients: project.AgeRecipients,
+		Comments:      project.Comments,
+		Variables:     topLevelGroup,
 	}
 	return nestedProject
 }
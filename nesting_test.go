@@ -1,6 +1,8 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -68,3 +70,34 @@ func TestNesting(t *testing.T) {
 		t.Fatalf(`result.Unnest() = %v, want %v`, unnested, project)
 	}
 }
+
+func TestReadMinimalFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"minimal.json": `{"project_id": 1, "variables": [{"key": "A"}, {"key": "B", "value": "b", "nested": [{"env": "production"}, {"env": "staging", "mask": true}]}]}`,
+		"minimal.yaml": "project_id: 1\nvariables:\n  - key: A\n  - key: B\n    value: b\n    nested:\n      - env: production\n      - env: staging\n        mask: true\n",
+	}
+	want := []Secret{
+		{Key: "A", VariableType: "env_var", Environment: "*"},
+		{Key: "B", Value: "b", VariableType: "env_var", Environment: "production"},
+		{Key: "B", Value: "b", VariableType: "env_var", Environment: "staging", Mask: true},
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		project := ProjectSecrets{}
+		if err := project.Read(path); err != nil {
+			t.Fatalf(`Read(%s) = %v`, name, err)
+		}
+		if len(project.Variables) != len(want) {
+			t.Fatalf(`Read(%s) = %+v, want %+v`, name, project.Variables, want)
+		}
+		for i, secret := range project.Variables {
+			if secret != want[i] {
+				t.Fatalf(`Read(%s) variable %d = %+v, want %+v`, name, i, secret, want[i])
+			}
+		}
+	}
+}
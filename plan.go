@@ -0,0 +1,217 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// VariableKey identifies a variable; GitLab allows the same key once per
+// environment scope.
+type VariableKey struct {
+	Key         string
+	Environment string
+}
+
+func (secret Secret) VariableKey() VariableKey {
+	return VariableKey{Key: secret.Key, Environment: secret.Environment}
+}
+
+func variablesByKey(variables []Secret) map[VariableKey]Secret {
+	byKey := make(map[VariableKey]Secret)
+	for _, secret := range variables {
+		byKey[secret.VariableKey()] = secret
+	}
+	return byKey
+}
+
+// Fingerprint returns a keyed hash over all fields of a variable, so plans
+// can refer to a variable state without containing its value. Without the
+// key, which is not part of the plan, guessed values cannot be checked
+// against it (see fingerprint_key.go).
+func Fingerprint(secret Secret, key string) string {
+	content, err := json.Marshal(secret)
+	if err != nil {
+		panic(err)
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(content)
+	return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// PlanChange is a single change to a remote variable. Old is the fingerprint
+// of the remote variable the plan was made against, New the fingerprint of
+// the local variable that will be written.
+type PlanChange struct {
+	Action      string `json:"action"`
+	Key         string `json:"key"`
+	Environment string `json:"env"`
+	Old         string `json:"old,omitempty"`
+	New         string `json:"new,omitempty"`
+}
+
+func (change PlanChange) VariableKey() VariableKey {
+	return VariableKey{Key: change.Key, Environment: change.Environment}
+}
+
+// Plan is the set of changes that makes the remote variables match the
+// local file. Saved plans are applied with `push --plan`.
+type Plan struct {
+	ProjectID int          `json:"project_id,omitempty"`
+	GroupID   string       `json:"group_id,omitempty"`
+	Instance  bool         `json:"instance,omitempty"`
+	GitlabURL string       `json:"gitlab_url"`
+	Changes   []PlanChange `json:"changes"`
+}
+
+func (plan Plan) Target() Target {
+	return Target{
+		ProjectID: plan.ProjectID,
+		GroupID:   plan.GroupID,
+		Instance:  plan.Instance,
+	}
+}
+
+// ComputePlan compares local with remote variables. Both are expected to be
+// ordered; changes are listed as creates, updates and then deletes. The
+// fingerprints are keyed with key; a saved plan is checked against a plan
+// made with the same key.
+func ComputePlan(local ProjectSecrets, remote ProjectSecrets, key string) Plan {
+	target := local.Target()
+	plan := Plan{
+		ProjectID: target.ProjectID,
+		GroupID:   target.GroupID,
+		Instance:  target.Instance,
+		GitlabURL: GitlabURL(),
+		Changes:   []PlanChange{},
+	}
+	localByKey := variablesByKey(local.Variables)
+	remoteByKey := variablesByKey(remote.Variables)
+
+	updates := []PlanChange{}
+	for _, localVar := range local.Variables {
+		remoteVar, found := remoteByKey[localVar.VariableKey()]
+		if !found {
+			plan.Changes = append(plan.Changes, PlanChange{
+				Action:      ActionCreate,
+				Key:         localVar.Key,
+				Environment: localVar.Environment,
+				New:         Fingerprint(localVar, key),
+			})
+			continue
+		}
+		if localVar == remoteVar {
+			continue
+		}
+		updates = append(updates, PlanChange{
+			Action:      ActionUpdate,
+			Key:         localVar.Key,
+			Environment: localVar.Environment,
+			Old:         Fingerprint(remoteVar, key),
+			New:         Fingerprint(localVar, key),
+		})
+	}
+	plan.Changes = append(plan.Changes, updates...)
+
+	for _, remoteVar := range remote.Variables {
+		if _, found := localByKey[remoteVar.VariableKey()]; found {
+			continue
+		}
+		plan.Changes = append(plan.Changes, PlanChange{
+			Action:      ActionDelete,
+			Key:         remoteVar.Key,
+			Environment: remoteVar.Environment,
+			Old:         Fingerprint(remoteVar, key),
+		})
+	}
+	return plan
+}
+
+// CheckDrift compares a saved plan with the plan for the current state and
+// describes every difference, so a plan is only applied as reviewed.
+func (plan Plan) CheckDrift(current Plan) error {
+	if plan.Target() != current.Target() {
+		return fmt.Errorf("plan was made for %s, but the variables file targets %s", plan.Target(), current.Target())
+	}
+	if plan.GitlabURL != current.GitlabURL {
+		return fmt.Errorf("plan was made for %s, but credder is configured for %s", plan.GitlabURL, current.GitlabURL)
+	}
+
+	currentByKey := make(map[VariableKey]PlanChange)
+	for _, change := range current.Changes {
+		currentByKey[change.VariableKey()] = change
+	}
+	problems := []string{}
+	for _, saved := range plan.Changes {
+		name := fmt.Sprintf("%s (%s)", saved.Key, saved.Environment)
+		change, found := currentByKey[saved.VariableKey()]
+		delete(currentByKey, saved.VariableKey())
+		switch {
+		case !found:
+			problems = append(problems, fmt.Sprintf("%s: planned %s is no longer needed", name, saved.Action))
+		case change.Action != saved.Action:
+			problems = append(problems, fmt.Sprintf("%s: planned %s, but now needs %s", name, saved.Action, change.Action))
+		case change.Old != saved.Old:
+			problems = append(problems, fmt.Sprintf("%s: remote variable changed since the plan was made", name))
+		case change.New != saved.New:
+			problems = append(problems, fmt.Sprintf("%s: local variable changed since the plan was made", name))
+		}
+	}
+	for _, change := range current.Changes {
+		if _, left := currentByKey[change.VariableKey()]; left {
+			problems = append(problems, fmt.Sprintf("%s (%s): %s is not part of the plan", change.Key, change.Environment, change.Action))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("state drifted since the plan was made:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// ApplyChange performs a planned change, using the variable from local for
+// creates and updates.
+func ApplyChange(target Target, change PlanChange, local map[VariableKey]Secret) error {
+	switch change.Action {
+	case ActionCreate:
+		return CreateVariable(target, local[change.VariableKey()])
+	case ActionUpdate:
+		return UpdateVariable(target, local[change.VariableKey()])
+	case ActionDelete:
+		return DeleteVariable(target, change.Key, change.Environment)
+	}
+	return fmt.Errorf("unknown action %s for %s (%s)", change.Action, change.Key, change.Environment)
+}
+
+func (plan Plan) Write(filename string) error {
+	content, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding plan: %w", err)
+	}
+	err = os.WriteFile(filename, content, 0644)
+	if err != nil {
+		return fmt.Errorf("could not write plan file: %w", err)
+	}
+	return nil
+}
+
+func (plan *Plan) Read(filename string) error {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("could not read plan file: %w", err)
+	}
+	err = json.Unmarshal(content, plan)
+	if err != nil {
+		return fmt.Errorf("error decoding plan: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestComputePlan(t *testing.T) {
+	gitlabURL = "https://gitlab.example.com"
+	defer func() { gitlabURL = "" }()
+
+	kept := Secret{Key: "KEPT", Value: "same", VariableType: "env_var", Environment: "*"}
+	changed := Secret{Key: "CHANGED", Value: "new", VariableType: "env_var", Environment: "*"}
+	changedRemote := changed
+	changedRemote.Value = "old"
+	created := Secret{Key: "CREATED", Value: "value", VariableType: "env_var", Environment: "production"}
+	deleted := Secret{Key: "DELETED", Value: "value", VariableType: "env_var", Environment: "*"}
+
+	local := ProjectSecrets{ProjectID: 1, Variables: []Secret{changed, created, kept}}
+	remote := ProjectSecrets{ProjectID: 1, Variables: []Secret{changedRemote, deleted, kept}}
+	plan := ComputePlan(local, remote, "key")
+
+	want := []PlanChange{
+		{Action: ActionCreate, Key: "CREATED", Environment: "production", New: Fingerprint(created, "key")},
+		{Action: ActionUpdate, Key: "CHANGED", Environment: "*", Old: Fingerprint(changedRemote, "key"), New: Fingerprint(changed, "key")},
+		{Action: ActionDelete, Key: "DELETED", Environment: "*", Old: Fingerprint(deleted, "key")},
+	}
+	if len(plan.Changes) != len(want) {
+		t.Fatalf("ComputePlan() = %v, want %v", plan.Changes, want)
+	}
+	for i, change := range plan.Changes {
+		if change != want[i] {
+			t.Fatalf("ComputePlan() change %d = %v, want %v", i, change, want[i])
+		}
+		if strings.Contains(change.Old+change.New, "value") {
+			t.Fatalf("ComputePlan() change %d contains a value: %v", i, change)
+		}
+	}
+	if plan.Target() != local.Target() || plan.GitlabURL != "https://gitlab.example.com" {
+		t.Fatalf("ComputePlan() = %v for %s, want project 1 on gitlab.example.com", plan.Target(), plan.GitlabURL)
+	}
+
+	if Fingerprint(changed, "key") == Fingerprint(changed, "other key") {
+		t.Fatalf("Fingerprint() does not depend on the key")
+	}
+}
+
+func TestCheckDrift(t *testing.T) {
+	saved := Plan{
+		ProjectID: 1,
+		GitlabURL: "https://gitlab.example.com",
+		Changes: []PlanChange{
+			{Action: ActionCreate, Key: "CREATED", Environment: "*", New: "hmac-sha256:1"},
+			{Action: ActionUpdate, Key: "CHANGED", Environment: "*", Old: "hmac-sha256:2", New: "hmac-sha256:3"},
+			{Action: ActionDelete, Key: "DELETED", Environment: "*", Old: "hmac-sha256:4"},
+		},
+	}
+	if err := saved.CheckDrift(saved); err != nil {
+		t.Fatalf("CheckDrift() of the same plan = %v, want no drift", err)
+	}
+
+	tests := []struct {
+		change  func(current *Plan)
+		message string
+	}{
+		{func(p *Plan) { p.ProjectID = 2 }, "plan was made for project 1, but the variables file targets project 2"},
+		{func(p *Plan) { p.ProjectID, p.GroupID = 0, "group" }, "plan was made for project 1, but the variables file targets group group"},
+		{func(p *Plan) { p.GitlabURL = "https://gitlab.com" }, "plan was made for https://gitlab.example.com, but credder is configured for https://gitlab.com"},
+		{func(p *Plan) { p.Changes[0].New = "hmac-sha256:5" }, "CREATED (*): local variable changed since the plan was made"},
+		{func(p *Plan) { p.Changes[1].Old = "hmac-sha256:5" }, "CHANGED (*): remote variable changed since the plan was made"},
+		{func(p *Plan) { p.Changes[1].New = "hmac-sha256:5" }, "CHANGED (*): local variable changed since the plan was made"},
+		{func(p *Plan) { p.Changes[2].Old = "hmac-sha256:5" }, "DELETED (*): remote variable changed since the plan was made"},
+		{func(p *Plan) { p.Changes[1].Action = ActionCreate }, "CHANGED (*): planned update, but now needs create"},
+		{func(p *Plan) { p.Changes = p.Changes[:2] }, "DELETED (*): planned delete is no longer needed"},
+		{func(p *Plan) {
+			p.Changes = append(p.Changes, PlanChange{Action: ActionCreate, Key: "NEW", Environment: "staging"})
+		}, "NEW (staging): create is not part of the plan"},
+	}
+	for _, test := range tests {
+		current := saved
+		current.Changes = append([]PlanChange{}, saved.Changes...)
+		test.change(&current)
+		err := saved.CheckDrift(current)
+		if err == nil || !strings.Contains(err.Error(), test.message) {
+			t.Fatalf("CheckDrift() = %v, want %q", err, test.message)
+		}
+	}
+}
+
+func TestLoadFingerprintKey(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	t.Setenv("CREDDER_FINGERPRINT_KEY", "")
+	t.Setenv("CREDDER_FINGERPRINT_KEY_FILE", "")
+
+	if _, err := LoadFingerprintKey(); err == nil {
+		t.Fatalf("LoadFingerprintKey() without a key = nil, want an error")
+	}
+	path, err := CreateFingerprintKey()
+	if err != nil {
+		t.Fatalf("CreateFingerprintKey() = %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("CreateFingerprintKey() wrote %s with %v (%v), want mode 0600", path, info, err)
+	}
+	first, err := LoadFingerprintKey()
+	if err != nil || first == "" {
+		t.Fatalf("LoadFingerprintKey() = %q, %v", first, err)
+	}
+	CreateFingerprintKey()
+	if second, _ := LoadFingerprintKey(); second != first {
+		t.Fatalf("CreateFingerprintKey() replaced the existing key")
+	}
+
+	t.Setenv("CREDDER_FINGERPRINT_KEY", "from env")
+	if key, _ := LoadFingerprintKey(); key != "from env" {
+		t.Fatalf("LoadFingerprintKey() = %q, want the environment variable", key)
+	}
+}
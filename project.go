@@ -2,20 +2,33 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"sort"
 )
 
 type NestedProjectSecrets struct {
-	ProjectID int            `json:"project_id"`
-	Variables []NestedSecret `json:"variables"`
+	ProjectID int    `json:"project_id,omitempty" yaml:"project_id,omitempty" toml:"project_id,omitempty"`
+	GroupID   string `json:"group_id,omitempty" yaml:"group_id,omitempty" toml:"group_id,omitempty"`
+	Instance  bool   `json:"instance,omitempty" yaml:"instance,omitempty" toml:"instance,omitempty"`
+	GitlabURL string `json:"gitlab_url,omitempty" yaml:"gitlab_url,omitempty" toml:"gitlab_url,omitempty"`
+	// Recipients that `credder encrypt` encrypts values for.
+	AgeRecipients []string `json:"age_recipients,omitempty" yaml:"age_recipients,omitempty" toml:"age_recipients,omitempty"`
+	// Deprecated: the fingerprint key is no longer kept in the variables
+	// file. It is still accepted, and dropped when the file is written.
+	FingerprintSalt string         `json:"fingerprint_salt,omitempty" yaml:"fingerprint_salt,omitempty" toml:"fingerprint_salt,omitempty"`
+	Variables       []NestedSecret `json:"variables" yaml:"variables" toml:"variables"`
+	// Comments of a .jsonc file, kept across rewrites.
+	Comments FileComments `json:"-" yaml:"-" toml:"-"`
 }
 
+// Write encodes the file in the format matching its extension.
 func (nestedProject *NestedProjectSecrets) Write(filename string) error {
-	content, err := json.MarshalIndent(nestedProject, "", "  ")
+	codec := codecForFile(filename)
+	content, err := codec.Marshal(nestedProject)
 	if err != nil {
-		fmt.Println("Error encoding JSON:", err)
+		fmt.Printf("Error encoding %s: %s\n", codec.Name, err)
 		return err
 	}
 	err = os.WriteFile(filename, content, 0644)
@@ -26,6 +39,8 @@ func (nestedProject *NestedProjectSecrets) Write(filename string) error {
 	return nil
 }
 
+// Read decodes the file in the format matching its extension (.json,
+// .jsonc, .yaml or .toml), rejecting unknown fields.
 func (nestedProject *NestedProjectSecrets) Read(filename string) error {
 	byteValue, err := os.ReadFile(filename)
 	if err != nil {
@@ -33,9 +48,10 @@ func (nestedProject *NestedProjectSecrets) Read(filename string) error {
 		return err
 	}
 
-	err = json.Unmarshal(byteValue, &nestedProject)
+	codec := codecForFile(filename)
+	err = codec.Unmarshal(filename, byteValue, nestedProject)
 	if err != nil {
-		fmt.Println("Error decoding JSON:", err)
+		fmt.Printf("Error decoding %s: %s\n", codec.Name, err)
 		return err
 	}
 	return nil
@@ -54,7 +70,7 @@ func (project *NestedProjectSecrets) Order() {
 }
 
 func (nestedProject NestedProjectSecrets) Equal(other NestedProjectSecrets) bool {
-	if nestedProject.ProjectID != other.ProjectID {
+	if nestedProject.ProjectID != other.ProjectID || nestedProject.GroupID != other.GroupID || nestedProject.Instance != other.Instance {
 		return false
 	}
 	if len(nestedProject.Variables) != len(other.Variables) {
@@ -68,9 +84,54 @@ func (nestedProject NestedProjectSecrets) Equal(other NestedProjectSecrets) bool
 	return true
 }
 
+// ProjectSecrets holds the variables of a project, a group or the instance.
+// At most one of ProjectID, GroupID and Instance is set; a file without any
+// of them targets project 0.
 type ProjectSecrets struct {
-	ProjectID int      `json:"project_id"`
-	Variables []Secret `json:"variables"`
+	ProjectID int    `json:"project_id,omitempty"`
+	GroupID   string `json:"group_id,omitempty"`
+	Instance  bool   `json:"instance,omitempty"`
+	GitlabURL string `json:"gitlab_url,omitempty"`
+	// Recipients that `credder encrypt` encrypts values for.
+	AgeRecipients []string `json:"age_recipients,omitempty"`
+	Variables     []Secret `json:"variables"`
+	// Comments of a .jsonc file, kept across rewrites.
+	Comments FileComments `json:"-"`
+}
+
+func (project ProjectSecrets) Target() Target {
+	return Target{
+		ProjectID: project.ProjectID,
+		GroupID:   project.GroupID,
+		Instance:  project.Instance,
+	}
+}
+
+// CheckTarget reports files that mix targets, and environment scopes on
+// instance variables, which GitLab does not support.
+func (project ProjectSecrets) CheckTarget() error {
+	targets := 0
+	if project.ProjectID != 0 {
+		targets++
+	}
+	if project.GroupID != "" {
+		targets++
+	}
+	if project.Instance {
+		targets++
+	}
+	if targets > 1 {
+		return errors.New("variables file must set only one of project_id, group_id and instance")
+	}
+	if !project.Instance {
+		return nil
+	}
+	for _, variable := range project.Variables {
+		if variable.Environment != "*" {
+			return fmt.Errorf("instance variable %s cannot have an environment scope (%s)", variable.Key, variable.Environment)
+		}
+	}
+	return nil
 }
 
 func (project *ProjectSecrets) Order() {
@@ -90,8 +151,21 @@ func (project *ProjectSecrets) Read(filename string) error {
 	}
 	unnested := nestedProject.Unnest()
 	project.ProjectID = unnested.ProjectID
+	project.GroupID = unnested.GroupID
+	project.Instance = unnested.Instance
+	project.GitlabURL = unnested.GitlabURL
+	project.AgeRecipients = unnested.AgeRecipients
+	project.Comments = unnested.Comments
 	project.Variables = unnested.Variables
 	project.Order()
+	err = project.CheckTarget()
+	if err != nil {
+		fmt.Println("Invalid variables file:", err)
+		return err
+	}
+	if project.GitlabURL != "" {
+		fileGitlabURL = project.GitlabURL
+	}
 	return nil
 }
 
@@ -116,7 +190,7 @@ func (project ProjectSecrets) FileVariables() []Secret {
 }
 
 func (project ProjectSecrets) Equal(other ProjectSecrets) bool {
-	if project.ProjectID != other.ProjectID {
+	if project.ProjectID != other.ProjectID || project.GroupID != other.GroupID || project.Instance != other.Instance {
 		return false
 	}
 	if len(project.Variables) != len(other.Variables) {
@@ -131,15 +205,15 @@ func (project ProjectSecrets) Equal(other ProjectSecrets) bool {
 }
 
 type NestedSecret struct {
-	Key          string         `json:"key,omitempty"`
-	Value        *string        `json:"value,omitempty"`
-	Description  *string        `json:"description,omitempty"`
-	VariableType *string        `json:"type,omitempty"`
-	Environment  *string        `json:"env,omitempty"`
-	Protect      *bool          `json:"protect,omitempty"`
-	Mask         *bool          `json:"mask,omitempty"`
-	Raw          *bool          `json:"raw,omitempty"`
-	Nested       []NestedSecret `json:"nested,omitempty"`
+	Key          string         `json:"key,omitempty" yaml:"key,omitempty" toml:"key,omitempty"`
+	Value        *string        `json:"value,omitempty" yaml:"value,omitempty" toml:"value,omitempty"`
+	Description  *string        `json:"description,omitempty" yaml:"description,omitempty" toml:"description,omitempty"`
+	VariableType *string        `json:"type,omitempty" yaml:"type,omitempty" toml:"type,omitempty"`
+	Environment  *string        `json:"env,omitempty" yaml:"env,omitempty" toml:"env,omitempty"`
+	Protect      *bool          `json:"protect,omitempty" yaml:"protect,omitempty" toml:"protect,omitempty"`
+	Mask         *bool          `json:"mask,omitempty" yaml:"mask,omitempty" toml:"mask,omitempty"`
+	Raw          *bool          `json:"raw,omitempty" yaml:"raw,omitempty" toml:"raw,omitempty"`
+	Nested       []NestedSecret `json:"nested,omitempty" yaml:"nested,omitempty" toml:"nested,omitempty"`
 }
 
 func (secret *NestedSecret) Equal(other NestedSecret) bool {
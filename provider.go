@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SecretProvider resolves secret references of one URI scheme, such as
+// op://vault/item/field, to the secret value.
+type SecretProvider interface {
+	Resolve(reference string) (string, error)
+}
+
+var secretProviders = map[string]SecretProvider{
+	"op":    &OnePasswordProvider{},
+	"vault": &VaultProvider{},
+	"age":   &AgeProvider{},
+	"env":   EnvProvider{},
+	"file":  FileProvider{},
+}
+
+// RegisterSecretProvider makes references with the given scheme resolvable.
+func RegisterSecretProvider(scheme string, provider SecretProvider) {
+	secretProviders[scheme] = provider
+	referencePattern = nil
+	schemePattern = nil
+}
+
+var referencePattern *regexp.Regexp
+var schemePattern *regexp.Regexp
+
+func referenceSchemes() string {
+	schemes := []string{}
+	for scheme := range secretProviders {
+		schemes = append(schemes, regexp.QuoteMeta(scheme))
+	}
+	sort.Strings(schemes)
+	return strings.Join(schemes, "|")
+}
+
+// getReferencePattern matches a value that is a reference as a whole, or a
+// reference enclosed in {{ }} anywhere in a value, for all registered schemes.
+func getReferencePattern() *regexp.Regexp {
+	if referencePattern != nil {
+		return referencePattern
+	}
+	reference := fmt.Sprintf(`(?:%s)://[^\s{}]+`, referenceSchemes())
+	referencePattern = regexp.MustCompile(fmt.Sprintf(`^\s*(%s)\s*$|\{\{\s*(%s)\s*\}\}`, reference, reference))
+	return referencePattern
+}
+
+// getSchemePattern matches the start of a reference anywhere in a value.
+func getSchemePattern() *regexp.Regexp {
+	if schemePattern != nil {
+		return schemePattern
+	}
+	schemePattern = regexp.MustCompile(fmt.Sprintf(`(?:^|[^A-Za-z0-9+.-])((?:%s)://)`, referenceSchemes()))
+	return schemePattern
+}
+
+// ResolveSecret resolves a single reference with the provider of its scheme.
+func ResolveSecret(reference string) (string, error) {
+	scheme, _, found := strings.Cut(reference, "://")
+	if !found {
+		return "", fmt.Errorf("%s is not a secret reference", reference)
+	}
+	provider, ok := secretProviders[scheme]
+	if !ok {
+		return "", fmt.Errorf("no secret provider for %s:// references", scheme)
+	}
+	return provider.Resolve(reference)
+}
+
+// ResolveReferences replaces all secret references in a value. A reference
+// inside a value that is not enclosed in {{ }} is an error rather than being
+// pushed as is, since where it ends is ambiguous.
+func ResolveReferences(value string) (string, error) {
+	rest := getReferencePattern().ReplaceAllString(value, " ")
+	if groups := getSchemePattern().FindStringSubmatch(rest); groups != nil {
+		return value, fmt.Errorf("%s reference inside a value must be enclosed in {{ }}", groups[1])
+	}
+	var resolveErr error
+	resolved := getReferencePattern().ReplaceAllStringFunc(value, func(match string) string {
+		groups := getReferencePattern().FindStringSubmatch(match)
+		reference := groups[1]
+		if reference == "" {
+			reference = groups[2]
+		}
+		secret, err := ResolveSecret(reference)
+		if err != nil {
+			if resolveErr == nil {
+				resolveErr = err
+			}
+			return match
+		}
+		return secret
+	})
+	return resolved, resolveErr
+}
+
+// EnvProvider resolves env://NAME from the environment.
+type EnvProvider struct{}
+
+func (EnvProvider) Resolve(reference string) (string, error) {
+	name := strings.TrimPrefix(reference, "env://")
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// FileProvider resolves file://path to the content of the file; relative
+// paths are relative to the working directory.
+type FileProvider struct{}
+
+func (FileProvider) Resolve(reference string) (string, error) {
+	path := strings.TrimPrefix(reference, "file://")
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("could not read secret file: %w", err)
+	}
+	return string(content), nil
+}
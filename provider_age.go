@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// AgeProvider decrypts age://<base64 ciphertext> values, so encrypted values
+// can be committed in the variables file. Identities are read from
+// CREDDER_AGE_KEY or CREDDER_AGE_KEY_FILE, falling back to the SOPS
+// locations (SOPS_AGE_KEY, SOPS_AGE_KEY_FILE, ~/.config/sops/age/keys.txt).
+type AgeProvider struct {
+	identities []age.Identity
+}
+
+func loadAgeIdentities() ([]age.Identity, error) {
+	for _, name := range []string{"CREDDER_AGE_KEY", "SOPS_AGE_KEY"} {
+		if key := os.Getenv(name); key != "" {
+			return age.ParseIdentities(strings.NewReader(key))
+		}
+	}
+	paths := []string{os.Getenv("CREDDER_AGE_KEY_FILE"), os.Getenv("SOPS_AGE_KEY_FILE")}
+	if config, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(config, "sops", "age", "keys.txt"))
+	}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read age key file: %w", err)
+		}
+		return age.ParseIdentities(bytes.NewReader(content))
+	}
+	return nil, errors.New("no age key found; set CREDDER_AGE_KEY or CREDDER_AGE_KEY_FILE")
+}
+
+func (provider *AgeProvider) Resolve(reference string) (string, error) {
+	if provider.identities == nil {
+		identities, err := loadAgeIdentities()
+		if err != nil {
+			return "", err
+		}
+		provider.identities = identities
+	}
+	return DecryptValue(reference, provider.identities)
+}
+
+// EncryptValue encrypts a value for the given age recipients.
+func EncryptValue(value string, recipients []string) (string, error) {
+	if len(recipients) == 0 {
+		return "", errors.New("no age recipients; add age_recipients to the variables file or pass --recipient")
+	}
+	parsed := []age.Recipient{}
+	for _, recipient := range recipients {
+		r, err := age.ParseX25519Recipient(recipient)
+		if err != nil {
+			return "", fmt.Errorf("invalid age recipient %s: %w", recipient, err)
+		}
+		parsed = append(parsed, r)
+	}
+
+	var ciphertext bytes.Buffer
+	writer, err := age.Encrypt(&ciphertext, parsed...)
+	if err != nil {
+		return "", fmt.Errorf("could not encrypt value: %w", err)
+	}
+	_, err = io.WriteString(writer, value)
+	if err != nil {
+		return "", fmt.Errorf("could not encrypt value: %w", err)
+	}
+	err = writer.Close()
+	if err != nil {
+		return "", fmt.Errorf("could not encrypt value: %w", err)
+	}
+	return "age://" + base64.StdEncoding.EncodeToString(ciphertext.Bytes()), nil
+}
+
+// DecryptValue decrypts an age://<base64 ciphertext> value.
+func DecryptValue(value string, identities []age.Identity) (string, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(strings.TrimSpace(value), "age://"))
+	if err != nil {
+		return "", fmt.Errorf("could not decode encrypted value: %w", err)
+	}
+	reader, err := age.Decrypt(bytes.NewReader(ciphertext), identities...)
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt value: %w", err)
+	}
+	plaintext, err := io.ReadAll(reader)
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+func IsEncryptedValue(value string) bool {
+	return strings.HasPrefix(strings.TrimSpace(value), "age://")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// OnePasswordProvider resolves op://vault/item/field references with the
+// 1Password CLI. Every reference is read once per run.
+type OnePasswordProvider struct {
+	cache map[string]string
+}
+
+func (provider *OnePasswordProvider) Resolve(reference string) (string, error) {
+	if value, ok := provider.cache[reference]; ok {
+		return value, nil
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("op", "read", "--no-newline", reference)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("could not read %s from 1Password: %w: %s", reference, err, strings.TrimSpace(stderr.String()))
+	}
+	if provider.cache == nil {
+		provider.cache = make(map[string]string)
+	}
+	provider.cache[reference] = stdout.String()
+	return stdout.String(), nil
+}
+
+// CreateOnePasswordItem stores fields as concealed values in a new item, so
+// they can be referenced as op://vault/title/field. The values are passed on
+// stdin, never as arguments.
+func CreateOnePasswordItem(vault string, title string, fields map[string]string) error {
+	var stderr bytes.Buffer
+	check := exec.Command("op", "item", "get", title, "--vault", vault)
+	check.Stderr = &stderr
+	if check.Run() == nil {
+		return fmt.Errorf("1Password item %s already exists in vault %s; choose another --op-item", title, vault)
+	}
+
+	type field struct {
+		ID    string `json:"id"`
+		Label string `json:"label"`
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+	item := struct {
+		Title    string  `json:"title"`
+		Category string  `json:"category"`
+		Fields   []field `json:"fields"`
+	}{Title: title, Category: "SECURE_NOTE", Fields: []field{}}
+	names := []string{}
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		item.Fields = append(item.Fields, field{ID: name, Label: name, Type: "CONCEALED", Value: fields[name]})
+	}
+	template, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("error encoding 1Password item: %w", err)
+	}
+
+	stderr.Reset()
+	cmd := exec.Command("op", "item", "create", "--vault", vault)
+	cmd.Stdin = bytes.NewReader(template)
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("could not create 1Password item %s: %w: %s", title, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
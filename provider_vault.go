@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// VaultProvider resolves vault://mount/path#field references against a
+// HashiCorp Vault KV version 2 secrets engine. It uses VAULT_ADDR and
+// VAULT_TOKEN (or the token the vault CLI stores in ~/.vault-token), and
+// VAULT_NAMESPACE when set. A specific version is read with ?version=N.
+type VaultProvider struct {
+	cache map[string]map[string]interface{}
+}
+
+type vaultReference struct {
+	Mount   string
+	Path    string
+	Field   string
+	Version string
+}
+
+func parseVaultReference(reference string) (vaultReference, error) {
+	rest := strings.TrimPrefix(reference, "vault://")
+	rest, field, _ := strings.Cut(rest, "#")
+	rest, query, _ := strings.Cut(rest, "?")
+	mount, path, found := strings.Cut(strings.Trim(rest, "/"), "/")
+	if !found || mount == "" || path == "" {
+		return vaultReference{}, fmt.Errorf("vault reference %s must look like vault://mount/path#field", reference)
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return vaultReference{}, fmt.Errorf("invalid query in vault reference %s: %w", reference, err)
+	}
+	return vaultReference{
+		Mount:   mount,
+		Path:    path,
+		Field:   field,
+		Version: values.Get("version"),
+	}, nil
+}
+
+func vaultToken() (string, error) {
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+	home, err := os.UserHomeDir()
+	if err == nil {
+		token, err := os.ReadFile(filepath.Join(home, ".vault-token"))
+		if err == nil {
+			return strings.TrimSpace(string(token)), nil
+		}
+	}
+	return "", errors.New("VAULT_TOKEN is not set and there is no ~/.vault-token")
+}
+
+// readSecret returns the key/value data of a KV v2 secret.
+func (provider *VaultProvider) readSecret(ref vaultReference) (map[string]interface{}, error) {
+	address := os.Getenv("VAULT_ADDR")
+	if address == "" {
+		return nil, errors.New("VAULT_ADDR is not set")
+	}
+	token, err := vaultToken()
+	if err != nil {
+		return nil, err
+	}
+
+	secretURL := fmt.Sprintf("%s/v1/%s/data/%s", strings.TrimRight(address, "/"), url.PathEscape(ref.Mount), ref.Path)
+	if ref.Version != "" {
+		secretURL += "?version=" + url.QueryEscape(ref.Version)
+	}
+	if data, ok := provider.cache[secretURL]; ok {
+		return data, nil
+	}
+
+	req, err := http.NewRequest("GET", secretURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create HTTP request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not make request to Vault: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not read %s/%s from Vault: %s", ref.Mount, ref.Path, resp.Status)
+	}
+
+	var body struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode Vault response: %w", err)
+	}
+	if provider.cache == nil {
+		provider.cache = make(map[string]map[string]interface{})
+	}
+	provider.cache[secretURL] = body.Data.Data
+	return body.Data.Data, nil
+}
+
+func (provider *VaultProvider) Resolve(reference string) (string, error) {
+	ref, err := parseVaultReference(reference)
+	if err != nil {
+		return "", err
+	}
+	data, err := provider.readSecret(ref)
+	if err != nil {
+		return "", err
+	}
+
+	field := ref.Field
+	if field == "" {
+		if len(data) != 1 {
+			fields := []string{}
+			for name := range data {
+				fields = append(fields, name)
+			}
+			sort.Strings(fields)
+			return "", fmt.Errorf("vault secret %s/%s has fields %s; pick one with #field", ref.Mount, ref.Path, strings.Join(fields, ", "))
+		}
+		for name := range data {
+			field = name
+		}
+	}
+	value, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("vault secret %s/%s has no field %s", ref.Mount, ref.Path, field)
+	}
+	if text, ok := value.(string); ok {
+		return text, nil
+	}
+	content, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("could not encode field %s of vault secret %s/%s: %w", field, ref.Mount, ref.Path, err)
+	}
+	return string(content), nil
+}
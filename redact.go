@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+// Values are redacted in diffs and prompts unless --show-secrets is given.
+var showSecrets = false
+
+// Key of value fingerprints, loaded on first use. Without a configured key,
+// a random one makes fingerprints comparable within one run only.
+var fingerprintKey = ""
+
+func valueFingerprintKey() string {
+	if fingerprintKey != "" {
+		return fingerprintKey
+	}
+	key, err := LoadFingerprintKey()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "warning:", err)
+		fmt.Fprintln(os.Stderr, "warning: fingerprints of values can only be compared within this run")
+		key = NewFingerprintKey()
+	}
+	fingerprintKey = key
+	return fingerprintKey
+}
+
+// lengthRange describes a length by its power of two range, so the exact
+// length of a value is not given away.
+func lengthRange(length int) string {
+	if length < 8 {
+		return "1-7"
+	}
+	if length >= 256 {
+		return "256+"
+	}
+	low := 8
+	for low*2 <= length {
+		low *= 2
+	}
+	return fmt.Sprintf("%d-%d", low, low*2-1)
+}
+
+// ValueFingerprint describes a value without revealing it: a short keyed
+// hash and the range of its length. Equal values have equal fingerprints.
+func ValueFingerprint(value string) string {
+	if value == "" {
+		return "(empty)"
+	}
+	mac := hmac.New(sha256.New, []byte(valueFingerprintKey()))
+	mac.Write([]byte(value))
+	return fmt.Sprintf("hmac-sha256:%s (%s chars)", hex.EncodeToString(mac.Sum(nil))[:12], lengthRange(utf8.RuneCountInString(value)))
+}
+
+// Redacted returns a copy of the secret with its value replaced by its
+// fingerprint, unless secrets are shown.
+func (secret Secret) Redacted() Secret {
+	if showSecrets {
+		return secret
+	}
+	secret.Value = ValueFingerprint(secret.Value)
+	return secret
+}
+
+func (project ProjectSecrets) Redacted() ProjectSecrets {
+	redacted := project
+	redacted.Variables = make([]Secret, len(project.Variables))
+	for i, secret := range project.Variables {
+		redacted.Variables[i] = secret.Redacted()
+	}
+	return redacted
+}
+
+// showValueDiff shows how a (file) value changes: a full diff when secrets
+// are shown, otherwise whether the fingerprint changed.
+func showValueDiff(w io.Writer, remote string, local string) {
+	if showSecrets {
+		showDiff(w, remote, local)
+		return
+	}
+	if remote == local {
+		fmt.Fprintf(w, "value: unchanged, %s\n", ValueFingerprint(local))
+		return
+	}
+	fmt.Fprintf(w, "value: changed, %s -> %s\n", ValueFingerprint(remote), ValueFingerprint(local))
+}
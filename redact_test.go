@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValueFingerprint(t *testing.T) {
+	defer func() { fingerprintKey = "" }()
+
+	fingerprintKey = "key"
+	fingerprint := ValueFingerprint("s3cr3t-value")
+	if fingerprint != ValueFingerprint("s3cr3t-value") {
+		t.Fatalf("ValueFingerprint() differs for equal values")
+	}
+	if !strings.HasSuffix(fingerprint, " (8-15 chars)") {
+		t.Fatalf("ValueFingerprint() = %q, want the length range 8-15", fingerprint)
+	}
+	if ValueFingerprint("") != "(empty)" {
+		t.Fatalf("ValueFingerprint() of empty = %q, want (empty)", ValueFingerprint(""))
+	}
+	fingerprintKey = "other key"
+	if ValueFingerprint("s3cr3t-value") == fingerprint {
+		t.Fatalf("ValueFingerprint() does not depend on the key")
+	}
+	// Characters are counted, not bytes.
+	if fingerprint := ValueFingerprint("äöüäöüä"); !strings.HasSuffix(fingerprint, " (1-7 chars)") {
+		t.Fatalf("ValueFingerprint() = %q, want the length range 1-7", fingerprint)
+	}
+
+	tests := []struct {
+		length int
+		want   string
+	}{
+		{1, "1-7"},
+		{7, "1-7"},
+		{8, "8-15"},
+		{31, "16-31"},
+		{32, "32-63"},
+		{255, "128-255"},
+		{256, "256+"},
+	}
+	for _, test := range tests {
+		if result := lengthRange(test.length); result != test.want {
+			t.Fatalf("lengthRange(%d) = %q, want %q", test.length, result, test.want)
+		}
+	}
+}
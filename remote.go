@@ -4,19 +4,64 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
-	"os/exec"
 	"strings"
 
+	"github.com/hashicorp/go-retryablehttp"
 	"github.com/xanzy/go-gitlab"
 )
 
+var DEFAULT_GITLAB_URL = "https://gitlab.com"
+
+// gitlabURL is the base URL given with --gitlab-url (or its environment
+// variables); fileGitlabURL is the one set in the variables file.
+var gitlabURL string
+var fileGitlabURL string
+
+// GitlabURL returns the base URL of the GitLab instance to talk to. An
+// explicit setting wins over the variables file, which wins over the
+// instance of the selected git remote; gitlab.com is the fallback.
+func GitlabURL() string {
+	if gitlabURL != "" {
+		return strings.TrimRight(gitlabURL, "/")
+	}
+	if fileGitlabURL != "" {
+		return strings.TrimRight(fileGitlabURL, "/")
+	}
+	if remoteURL := remoteGitlabURL(); remoteURL != "" {
+		return remoteURL
+	}
+	return DEFAULT_GITLAB_URL
+}
+
+func gitlabApiURL() string {
+	return GitlabURL() + "/api/v4"
+}
+
+var remoteGitlabURLCache *string
+
+// remoteGitlabURL returns the instance URL of the selected git remote, or an
+// empty string when it cannot be determined.
+func remoteGitlabURL() string {
+	if remoteGitlabURLCache != nil {
+		return *remoteGitlabURLCache
+	}
+	webURL := ""
+	remote, err := GetGitRemote()
+	if err == nil {
+		webURL = remote.WebURL()
+	}
+	remoteGitlabURLCache = &webURL
+	return webURL
+}
+
 func GetProjectIdFromPath(path string) (int, error) {
 	path = strings.ReplaceAll(path, "/", "%2F")
 	token := os.Getenv("GL_PAT")
-	url := fmt.Sprintf("https://gitlab.com/api/v4/projects/%s", path)
+	url := fmt.Sprintf("%s/projects/%s", gitlabApiURL(), path)
 
 	cacheKey := fmt.Sprintf("projectid_%s", url)
 	if val, ok := GetLintCacheI(cacheKey); ok {
@@ -34,6 +79,9 @@ func GetProjectIdFromPath(path string) (int, error) {
 		return 0, fmt.Errorf("could not make request to GitLab API: %w", err)
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("could not get project %s from %s: %s", path, GitlabURL(), resp.Status)
+	}
 
 	var data map[string]interface{}
 	err = json.NewDecoder(resp.Body).Decode(&data)
@@ -48,38 +96,66 @@ func GetProjectIdFromPath(path string) (int, error) {
 	return id, nil
 }
 
-func GetProjectID() int {
-	cmd := exec.Command("git", "remote", "get-url", "origin")
-	output, err := cmd.CombinedOutput()
+// GetProjectID returns the ID of the project behind the selected git remote.
+func GetProjectID() (int, error) {
+	remote, err := GetGitRemote()
 	if err != nil {
-		log.Fatalln("Could not get project id:", err)
+		return 0, fmt.Errorf("could not get project id: %w", err)
 	}
-	a := string(output)
-	a = strings.Split(a, ":")[1]
-	a = strings.Split(a, ".git")[0]
 
-	id, err := GetProjectIdFromPath(a)
+	id, err := GetProjectIdFromPath(remote.Path)
 	if err != nil {
-		log.Fatalln("Could not get project id:", err)
+		return 0, fmt.Errorf("could not get project id: %w", err)
 	}
-	return id
+	return id, nil
 }
 
 func getGitlabClient() *gitlab.Client {
-	git, err := gitlab.NewClient(os.Getenv("GL_PAT"))
+	git, err := gitlab.NewClient(os.Getenv("GL_PAT"), gitlab.WithBaseURL(gitlabApiURL()))
 	if err != nil {
 		log.Fatal("Could not create GitLab client:", err)
 	}
 	return git
 }
 
-func remoteToLocal(project_id int, remote []*gitlab.ProjectVariable) ProjectSecrets {
-	local := ProjectSecrets{
-		ProjectID: project_id,
-		Variables: []Secret{},
+// Target identifies the owner of a set of variables on GitLab: a project
+// (by ID), a group (by ID or full path) or the whole instance.
+type Target struct {
+	ProjectID int
+	GroupID   string
+	Instance  bool
+}
+
+func (target Target) IsGroup() bool {
+	return !target.Instance && target.GroupID != ""
+}
+
+func (target Target) String() string {
+	if target.Instance {
+		return "instance"
+	}
+	if target.IsGroup() {
+		return fmt.Sprintf("group %s", target.GroupID)
+	}
+	return fmt.Sprintf("project %d", target.ProjectID)
+}
+
+// withEnvironmentScope adds the environment scope filter as a query parameter.
+// The group variables API accepts the filter, but the client has no option
+// field for it.
+func withEnvironmentScope(environment string) gitlab.RequestOptionFunc {
+	return func(req *retryablehttp.Request) error {
+		query := req.URL.Query()
+		query.Set("filter[environment_scope]", environment)
+		req.URL.RawQuery = query.Encode()
+		return nil
 	}
+}
+
+func projectVariablesToSecrets(remote []*gitlab.ProjectVariable) []Secret {
+	secrets := []Secret{}
 	for i := 0; i < len(remote); i++ {
-		local.Variables = append(local.Variables, Secret{
+		secrets = append(secrets, Secret{
 			Key:          remote[i].Key,
 			Value:        remote[i].Value,
 			Description:  remote[i].Description,
@@ -90,15 +166,45 @@ func remoteToLocal(project_id int, remote []*gitlab.ProjectVariable) ProjectSecr
 			Raw:          remote[i].Raw,
 		})
 	}
-	return local
+	return secrets
 }
 
-// FetchVariables fetches the project variables for a given project ID from GitLab.
-// It returns a struct of type ProjectSecrets that contains the fetched variables,
-// or an error if the fetching process fails.
-func (project *ProjectSecrets) FetchVariables(project_id int) error {
-	git := getGitlabClient()
+func groupVariablesToSecrets(remote []*gitlab.GroupVariable) []Secret {
+	secrets := []Secret{}
+	for i := 0; i < len(remote); i++ {
+		secrets = append(secrets, Secret{
+			Key:          remote[i].Key,
+			Value:        remote[i].Value,
+			Description:  remote[i].Description,
+			VariableType: string(remote[i].VariableType),
+			Environment:  remote[i].EnvironmentScope,
+			Protect:      remote[i].Protected,
+			Mask:         remote[i].Masked,
+			Raw:          remote[i].Raw,
+		})
+	}
+	return secrets
+}
+
+func instanceVariablesToSecrets(remote []*gitlab.InstanceVariable) []Secret {
+	secrets := []Secret{}
+	for i := 0; i < len(remote); i++ {
+		secrets = append(secrets, Secret{
+			Key:          remote[i].Key,
+			Value:        remote[i].Value,
+			Description:  remote[i].Description,
+			VariableType: string(remote[i].VariableType),
+			// Instance variables apply to every environment.
+			Environment: "*",
+			Protect:     remote[i].Protected,
+			Mask:        remote[i].Masked,
+			Raw:         remote[i].Raw,
+		})
+	}
+	return secrets
+}
 
+func fetchProjectVariables(git *gitlab.Client, project_id int) ([]Secret, error) {
 	var variables []*gitlab.ProjectVariable
 	page := 1
 	perPage := 100
@@ -111,7 +217,34 @@ func (project *ProjectSecrets) FetchVariables(project_id int) error {
 
 		vars, resp, err := git.ProjectVariables.ListVariables(project_id, opts)
 		if err != nil {
-			return err
+			return nil, err
+		}
+
+		variables = append(variables, vars...)
+
+		if resp.CurrentPage >= resp.TotalPages {
+			break
+		}
+
+		page = resp.NextPage
+	}
+	return projectVariablesToSecrets(variables), nil
+}
+
+func fetchGroupVariables(git *gitlab.Client, group_id string) ([]Secret, error) {
+	var variables []*gitlab.GroupVariable
+	page := 1
+	perPage := 100
+
+	for {
+		opts := &gitlab.ListGroupVariablesOptions{
+			Page:    page,
+			PerPage: perPage,
+		}
+
+		vars, resp, err := git.GroupVariables.ListVariables(group_id, opts)
+		if err != nil {
+			return nil, err
 		}
 
 		variables = append(variables, vars...)
@@ -122,22 +255,96 @@ func (project *ProjectSecrets) FetchVariables(project_id int) error {
 
 		page = resp.NextPage
 	}
-	filled := remoteToLocal(project_id, variables)
-	project.ProjectID = project_id
-	project.Variables = filled.Variables
+	return groupVariablesToSecrets(variables), nil
+}
+
+func fetchInstanceVariables(git *gitlab.Client) ([]Secret, error) {
+	var variables []*gitlab.InstanceVariable
+	page := 1
+	perPage := 100
+
+	for {
+		opts := &gitlab.ListInstanceVariablesOptions{
+			Page:    page,
+			PerPage: perPage,
+		}
+
+		vars, resp, err := git.InstanceVariables.ListVariables(opts)
+		if err != nil {
+			return nil, err
+		}
+
+		variables = append(variables, vars...)
+
+		if resp.CurrentPage >= resp.TotalPages {
+			break
+		}
+
+		page = resp.NextPage
+	}
+	return instanceVariablesToSecrets(variables), nil
+}
+
+// FetchVariables fetches the variables of a project, group or instance from GitLab.
+// It fills the receiver with the fetched variables, or returns an error
+// if the fetching process fails.
+func (project *ProjectSecrets) FetchVariables(target Target) error {
+	git := getGitlabClient()
+
+	var variables []Secret
+	var err error
+	if target.Instance {
+		variables, err = fetchInstanceVariables(git)
+	} else if target.IsGroup() {
+		variables, err = fetchGroupVariables(git, target.GroupID)
+	} else {
+		variables, err = fetchProjectVariables(git, target.ProjectID)
+	}
+	if err != nil {
+		return err
+	}
+	project.ProjectID = target.ProjectID
+	project.GroupID = target.GroupID
+	project.Instance = target.Instance
+	project.Variables = variables
 	project.Order()
 
 	return nil
 }
 
-// CreateVariable creates a new variable for a project in GitLab.
-// It takes the project ID and a Secret variable as parameters.
+// CreateVariable creates a new variable for a project, group or instance in GitLab.
+// It takes the target and a Secret variable as parameters.
 // The function returns an error if the variable creation fails.
-func CreateVariable(projectId int, variable Secret) error {
+func CreateVariable(target Target, variable Secret) error {
 	git := getGitlabClient()
 
 	variableType := gitlab.VariableTypeValue(variable.VariableType)
-	_, _, err := git.ProjectVariables.CreateVariable(projectId, &gitlab.CreateProjectVariableOptions{
+	if target.Instance {
+		_, _, err := git.InstanceVariables.CreateVariable(&gitlab.CreateInstanceVariableOptions{
+			Key:          &variable.Key,
+			Value:        &variable.Value,
+			Description:  &variable.Description,
+			Masked:       &variable.Mask,
+			Raw:          &variable.Raw,
+			Protected:    &variable.Protect,
+			VariableType: &variableType,
+		})
+		return err
+	}
+	if target.IsGroup() {
+		_, _, err := git.GroupVariables.CreateVariable(target.GroupID, &gitlab.CreateGroupVariableOptions{
+			Key:              &variable.Key,
+			Value:            &variable.Value,
+			Description:      &variable.Description,
+			EnvironmentScope: &variable.Environment,
+			Masked:           &variable.Mask,
+			Raw:              &variable.Raw,
+			Protected:        &variable.Protect,
+			VariableType:     &variableType,
+		})
+		return err
+	}
+	_, _, err := git.ProjectVariables.CreateVariable(target.ProjectID, &gitlab.CreateProjectVariableOptions{
 		Key:              &variable.Key,
 		Value:            &variable.Value,
 		Description:      &variable.Description,
@@ -150,14 +357,37 @@ func CreateVariable(projectId int, variable Secret) error {
 	return err
 }
 
-// UpdateVariable updates a variable for a given project in GitLab.
-// It takes the project ID and a Secret variable as parameters.
+// UpdateVariable updates a variable for a given project, group or instance in GitLab.
+// It takes the target and a Secret variable as parameters.
 // Returns an error if the update operation fails.
-func UpdateVariable(projectId int, variable Secret) error {
+func UpdateVariable(target Target, variable Secret) error {
 	git := getGitlabClient()
 
 	variableType := gitlab.VariableTypeValue(variable.VariableType)
-	_, _, err := git.ProjectVariables.UpdateVariable(projectId, variable.Key, &gitlab.UpdateProjectVariableOptions{
+	if target.Instance {
+		_, _, err := git.InstanceVariables.UpdateVariable(variable.Key, &gitlab.UpdateInstanceVariableOptions{
+			Value:        &variable.Value,
+			Description:  &variable.Description,
+			Masked:       &variable.Mask,
+			Raw:          &variable.Raw,
+			Protected:    &variable.Protect,
+			VariableType: &variableType,
+		})
+		return err
+	}
+	if target.IsGroup() {
+		_, _, err := git.GroupVariables.UpdateVariable(target.GroupID, variable.Key, &gitlab.UpdateGroupVariableOptions{
+			Value:            &variable.Value,
+			Description:      &variable.Description,
+			EnvironmentScope: &variable.Environment,
+			Masked:           &variable.Mask,
+			Raw:              &variable.Raw,
+			Protected:        &variable.Protect,
+			VariableType:     &variableType,
+		}, withEnvironmentScope(variable.Environment))
+		return err
+	}
+	_, _, err := git.ProjectVariables.UpdateVariable(target.ProjectID, variable.Key, &gitlab.UpdateProjectVariableOptions{
 		Value:            &variable.Value,
 		Description:      &variable.Description,
 		EnvironmentScope: &variable.Environment,
@@ -172,12 +402,21 @@ func UpdateVariable(projectId int, variable Secret) error {
 	return err
 }
 
-// DeleteVariable removes a variable from a project in GitLab.
-// It takes the project ID, variable key, and environment scope as parameters.
+// DeleteVariable removes a variable from a project, group or instance in GitLab.
+// It takes the target, variable key, and environment scope as parameters;
+// the environment scope is ignored for instance variables.
 // Returns an error if the variable deletion fails.
-func DeleteVariable(projectId int, key string, environment string) error {
+func DeleteVariable(target Target, key string, environment string) error {
 	git := getGitlabClient()
-	_, err := git.ProjectVariables.RemoveVariable(projectId, key, &gitlab.RemoveProjectVariableOptions{
+	if target.Instance {
+		_, err := git.InstanceVariables.RemoveVariable(key)
+		return err
+	}
+	if target.IsGroup() {
+		_, err := git.GroupVariables.RemoveVariable(target.GroupID, key, withEnvironmentScope(environment))
+		return err
+	}
+	_, err := git.ProjectVariables.RemoveVariable(target.ProjectID, key, &gitlab.RemoveProjectVariableOptions{
 		Filter: &gitlab.VariableFilter{
 			EnvironmentScope: environment,
 		},
@@ -185,14 +424,23 @@ func DeleteVariable(projectId int, key string, environment string) error {
 	return err
 }
 
-func GetFileFromProjectIdAndPath(projectId int, path string) (string, error) {
+// GetFileFromProjectIdAndPath returns a file of a project at a ref; an empty
+// ref means the default branch.
+func GetFileFromProjectIdAndPath(projectId int, path string, ref string) (string, error) {
 	git := getGitlabClient()
 	path = strings.TrimLeft(path, "/")
-	cacheKey := fmt.Sprintf("file_%d_%s", projectId, path)
+	if ref == "" {
+		defaultBranch, err := GetDefaultBranch(projectId)
+		if err != nil {
+			return "", err
+		}
+		ref = defaultBranch
+	}
+	cacheKey := fmt.Sprintf("file_%d_%s_%s", projectId, ref, path)
 	var content string
 	if val, ok := GetLintCache(cacheKey); !ok {
 		file, _, err := git.RepositoryFiles.GetFile(projectId, path, &gitlab.GetFileOptions{
-			Ref: gitlab.Ptr("master"),
+			Ref: gitlab.Ptr(ref),
 		})
 		if err != nil {
 			return "", err
@@ -209,7 +457,7 @@ func GetFileFromProjectIdAndPath(projectId int, path string) (string, error) {
 	return content, nil
 }
 
-func GetCiConfigPath(projectId int) (string, error) {
+func getProject(projectId int) (*gitlab.Project, error) {
 	git := getGitlabClient()
 	cacheKey := fmt.Sprintf("project_%d", projectId)
 
@@ -217,13 +465,148 @@ func GetCiConfigPath(projectId int) (string, error) {
 	if val, ok := GetLintCacheB(cacheKey); !ok {
 		proj, _, err := git.Projects.GetProject(projectId, &gitlab.GetProjectOptions{})
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		project = proj
 		SetLintCache(cacheKey, project)
 	} else {
 		json.Unmarshal(val, project)
 	}
+	return project, nil
+}
+
+func GetDefaultBranch(projectId int) (string, error) {
+	project, err := getProject(projectId)
+	if err != nil {
+		return "", err
+	}
+	if project.DefaultBranch == "" {
+		return "", fmt.Errorf("project %d has no default branch", projectId)
+	}
+	return project.DefaultBranch, nil
+}
+
+// ListProjectFiles returns the paths of all files of a project at a ref.
+func ListProjectFiles(projectId int, ref string) ([]string, error) {
+	git := getGitlabClient()
+	cacheKey := fmt.Sprintf("tree_%d_%s", projectId, ref)
+	paths := []string{}
+	if val, ok := GetLintCacheB(cacheKey); ok {
+		err := json.Unmarshal(val, &paths)
+		return paths, err
+	}
+
+	options := &gitlab.ListTreeOptions{
+		ListOptions: gitlab.ListOptions{PerPage: 100},
+		Recursive:   gitlab.Ptr(true),
+	}
+	if ref != "" {
+		options.Ref = gitlab.Ptr(ref)
+	}
+	for {
+		nodes, resp, err := git.Repositories.ListTree(projectId, options)
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range nodes {
+			if node.Type == "blob" {
+				paths = append(paths, node.Path)
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		options.Page = resp.NextPage
+	}
+	SetLintCache(cacheKey, paths)
+	return paths, nil
+}
+
+// ListReleaseTags returns the tags of the releases of a project.
+func ListReleaseTags(projectId int) ([]string, error) {
+	git := getGitlabClient()
+	cacheKey := fmt.Sprintf("releases_%d", projectId)
+	tags := []string{}
+	if val, ok := GetLintCacheB(cacheKey); ok {
+		err := json.Unmarshal(val, &tags)
+		return tags, err
+	}
+
+	options := &gitlab.ListReleasesOptions{ListOptions: gitlab.ListOptions{PerPage: 100}}
+	for {
+		releases, resp, err := git.Releases.ListReleases(projectId, options)
+		if err != nil {
+			return nil, err
+		}
+		for _, release := range releases {
+			tags = append(tags, release.TagName)
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		options.Page = resp.NextPage
+	}
+	SetLintCache(cacheKey, tags)
+	return tags, nil
+}
+
+// IsTag reports whether a ref of a project is a tag rather than a branch.
+func IsTag(projectId int, ref string) (bool, error) {
+	git := getGitlabClient()
+	_, resp, err := git.Tags.GetTag(projectId, ref)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetCiTemplate returns one of GitLab's CI templates, such as
+// Auto-DevOps.gitlab-ci.yml or Jobs/Build.gitlab-ci.yml.
+func GetCiTemplate(name string) (string, error) {
+	git := getGitlabClient()
+	key := strings.TrimSuffix(name, ".gitlab-ci.yml")
+	cacheKey := fmt.Sprintf("template_%s_%s", GitlabURL(), key)
+	if val, ok := GetLintCache(cacheKey); ok {
+		return val, nil
+	}
+	template, _, err := git.CIYMLTemplate.GetTemplate(key)
+	if err != nil {
+		return "", err
+	}
+	SetLintCacheS(cacheKey, template.Content)
+	return template.Content, nil
+}
+
+// GetRemoteFile downloads a public file for include:remote.
+func GetRemoteFile(url string) (string, error) {
+	cacheKey := fmt.Sprintf("remote_%s", url)
+	if val, ok := GetLintCache(cacheKey); ok {
+		return val, nil
+	}
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("could not download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("could not download %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("could not download %s: %w", url, err)
+	}
+	SetLintCacheS(cacheKey, string(data))
+	return string(data), nil
+}
+
+func GetCiConfigPath(projectId int) (string, error) {
+	project, err := getProject(projectId)
+	if err != nil {
+		return "", err
+	}
 	if project.CIConfigPath == "" {
 		return ".gitlab-ci.yml", nil
 	}
@@ -231,8 +614,16 @@ func GetCiConfigPath(projectId int) (string, error) {
 }
 
 func LintCiFromString(content string) (gitlab.ProjectLintResult, error) {
+	pid, err := GetProjectID()
+	if err != nil {
+		return gitlab.ProjectLintResult{}, err
+	}
+	return LintCiForProject(pid, content)
+}
+
+// LintCiForProject lints a configuration in the context of a project.
+func LintCiForProject(pid int, content string) (gitlab.ProjectLintResult, error) {
 	git := getGitlabClient()
-	pid := GetProjectID()
 	cacheKey := fmt.Sprintf("lint_%d_%s", pid, content)
 	lintResult := &gitlab.ProjectLintResult{}
 	if val, ok := GetLintCache(cacheKey); !ok {
@@ -250,3 +641,40 @@ func LintCiFromString(content string) (gitlab.ProjectLintResult, error) {
 	}
 	return *lintResult, nil
 }
+
+// DryRunResult is a lint result with the jobs a pipeline would have.
+type DryRunResult struct {
+	gitlab.ProjectLintResult
+	Jobs []DryRunJob `json:"jobs"`
+}
+
+type DryRunJob struct {
+	Name         string `json:"name"`
+	Stage        string `json:"stage"`
+	When         string `json:"when"`
+	AllowFailure bool   `json:"allow_failure"`
+}
+
+// DryRunCi simulates creating a pipeline for a ref with a configuration.
+// An empty ref means the default branch. Results are not cached, they depend
+// on the state of the ref.
+func DryRunCi(pid int, content string, ref string) (DryRunResult, error) {
+	git := getGitlabClient()
+	result := DryRunResult{}
+
+	options := &gitlab.ProjectNamespaceLintOptions{
+		Content:     gitlab.Ptr(content),
+		DryRun:      gitlab.Ptr(true),
+		IncludeJobs: gitlab.Ptr(true),
+	}
+	if ref != "" {
+		options.Ref = gitlab.Ptr(ref)
+	}
+	// The client's lint result has no jobs, so the request is made here.
+	req, err := git.NewRequest(http.MethodPost, fmt.Sprintf("projects/%d/ci/lint", pid), options, nil)
+	if err != nil {
+		return result, err
+	}
+	_, err = git.Do(req, &result)
+	return result, err
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Evaluation of the expressions of rules:if, e.g.
+//   $CI_COMMIT_BRANCH == "main" && ($DEPLOY || $CI_COMMIT_TAG =~ /^v\d+/)
+// Variables that are not set are null, like in a pipeline.
+
+type ruleValueKind int
+
+const (
+	ruleNull ruleValueKind = iota
+	ruleString
+	ruleRegex
+	ruleBool
+)
+
+type ruleValue struct {
+	Kind ruleValueKind
+	Text string
+	Bool bool
+}
+
+func (value ruleValue) truthy() bool {
+	switch value.Kind {
+	case ruleBool:
+		return value.Bool
+	case ruleString:
+		return value.Text != ""
+	case ruleRegex:
+		return true
+	}
+	return false
+}
+
+// regex compiles a /pattern/flags literal; a string holding one works too.
+func (value ruleValue) regex() (*regexp.Regexp, error) {
+	literal := value.Text
+	end := strings.LastIndex(literal, "/")
+	if (value.Kind != ruleRegex && value.Kind != ruleString) || !strings.HasPrefix(literal, "/") || end < 1 {
+		return nil, fmt.Errorf("%q is not a regular expression", literal)
+	}
+	pattern, flags := literal[1:end], literal[end+1:]
+	if strings.Contains(flags, "i") {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+var ruleToken = regexp.MustCompile(`^(?:\s+|&&|\|\||==|!=|=~|!~|\(|\)|null\b|\$\{[A-Za-z_][A-Za-z0-9_]*\}|\$[A-Za-z_][A-Za-z0-9_]*|"[^"]*"|'[^']*'|/(?:\\.|[^/\\])*/[a-z]*)`)
+
+func tokenizeRule(expression string) ([]string, error) {
+	tokens := []string{}
+	rest := expression
+	for rest != "" {
+		token := ruleToken.FindString(rest)
+		if token == "" {
+			return nil, fmt.Errorf("invalid expression %q at %q", expression, rest)
+		}
+		rest = rest[len(token):]
+		if strings.TrimSpace(token) != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+type ruleParser struct {
+	tokens    []string
+	position  int
+	variables map[string]string
+}
+
+func (parser *ruleParser) peek() string {
+	if parser.position < len(parser.tokens) {
+		return parser.tokens[parser.position]
+	}
+	return ""
+}
+
+func (parser *ruleParser) next() string {
+	token := parser.peek()
+	parser.position++
+	return token
+}
+
+func (parser *ruleParser) or() (ruleValue, error) {
+	left, err := parser.and()
+	for err == nil && parser.peek() == "||" {
+		parser.next()
+		var right ruleValue
+		right, err = parser.and()
+		left = ruleValue{Kind: ruleBool, Bool: left.truthy() || right.truthy()}
+	}
+	return left, err
+}
+
+func (parser *ruleParser) and() (ruleValue, error) {
+	left, err := parser.comparison()
+	for err == nil && parser.peek() == "&&" {
+		parser.next()
+		var right ruleValue
+		right, err = parser.comparison()
+		left = ruleValue{Kind: ruleBool, Bool: left.truthy() && right.truthy()}
+	}
+	return left, err
+}
+
+func (parser *ruleParser) comparison() (ruleValue, error) {
+	left, err := parser.primary()
+	if err != nil {
+		return left, err
+	}
+	operator := parser.peek()
+	if operator != "==" && operator != "!=" && operator != "=~" && operator != "!~" {
+		return left, nil
+	}
+	parser.next()
+	right, err := parser.primary()
+	if err != nil {
+		return right, err
+	}
+
+	result := false
+	switch operator {
+	case "==", "!=":
+		result = left.Kind == right.Kind && left.Text == right.Text
+		if operator == "!=" {
+			result = !result
+		}
+	case "=~", "!~":
+		pattern, err := right.regex()
+		if err != nil {
+			return ruleValue{}, err
+		}
+		result = left.Kind == ruleString && pattern.MatchString(left.Text)
+		if operator == "!~" {
+			result = !result
+		}
+	}
+	return ruleValue{Kind: ruleBool, Bool: result}, nil
+}
+
+func (parser *ruleParser) primary() (ruleValue, error) {
+	token := parser.next()
+	switch {
+	case token == "(":
+		value, err := parser.or()
+		if err != nil {
+			return value, err
+		}
+		if parser.next() != ")" {
+			return value, fmt.Errorf("missing ) in expression")
+		}
+		return value, nil
+	case token == "null":
+		return ruleValue{Kind: ruleNull}, nil
+	case strings.HasPrefix(token, "$"):
+		name := strings.Trim(token, "${}")
+		value, found := parser.variables[name]
+		if !found {
+			return ruleValue{Kind: ruleNull}, nil
+		}
+		return ruleValue{Kind: ruleString, Text: value}, nil
+	case strings.HasPrefix(token, `"`), strings.HasPrefix(token, "'"):
+		return ruleValue{Kind: ruleString, Text: token[1 : len(token)-1]}, nil
+	case strings.HasPrefix(token, "/"):
+		return ruleValue{Kind: ruleRegex, Text: token}, nil
+	case token == "":
+		return ruleValue{}, fmt.Errorf("unexpected end of expression")
+	}
+	return ruleValue{}, fmt.Errorf("unexpected %q in expression", token)
+}
+
+// EvaluateRule evaluates a rules:if expression with the given variables.
+func EvaluateRule(expression string, variables map[string]string) (bool, error) {
+	tokens, err := tokenizeRule(expression)
+	if err != nil {
+		return false, err
+	}
+	parser := ruleParser{tokens: tokens, variables: variables}
+	value, err := parser.or()
+	if err != nil {
+		return false, fmt.Errorf("invalid expression %q: %w", expression, err)
+	}
+	if parser.position < len(tokens) {
+		return false, fmt.Errorf("invalid expression %q: unexpected %q", expression, parser.peek())
+	}
+	return value.truthy(), nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestEvaluateRule(t *testing.T) {
+	variables := map[string]string{
+		"CI_COMMIT_BRANCH": "main",
+		"CI_COMMIT_TAG":    "v1.2.3",
+		"EMPTY":            "",
+		"PATTERN":          "/^feature-/",
+	}
+	tests := []struct {
+		expression string
+		want       bool
+	}{
+		{`$CI_COMMIT_BRANCH == "main"`, true},
+		{`$CI_COMMIT_BRANCH != 'main'`, false},
+		{`$UNDEFINED`, false},
+		{`$EMPTY`, false},
+		{`$UNDEFINED == null`, true},
+		{`$EMPTY == null`, false},
+		{`$CI_COMMIT_TAG =~ /^V\d+/i`, true},
+		{`$CI_COMMIT_TAG !~ /^v\d+/`, false},
+		{`"feature-x" =~ $PATTERN`, true},
+		{`$UNDEFINED || $CI_COMMIT_BRANCH == "main" && $CI_COMMIT_TAG`, true},
+		{`($UNDEFINED || $CI_COMMIT_BRANCH == "main") && $EMPTY`, false},
+		{`${CI_COMMIT_BRANCH} == "main"`, true},
+	}
+	for _, test := range tests {
+		got, err := EvaluateRule(test.expression, variables)
+		if err != nil {
+			t.Fatalf(`EvaluateRule(%q) failed: %s`, test.expression, err)
+		}
+		if got != test.want {
+			t.Errorf(`EvaluateRule(%q) = %v, want %v`, test.expression, got, test.want)
+		}
+	}
+
+	for _, invalid := range []string{`$A ==`, `($A`, `$A = "b"`} {
+		if _, err := EvaluateRule(invalid, variables); err == nil {
+			t.Errorf(`EvaluateRule(%q) succeeded, want an error`, invalid)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// VariablesFileSchema returns a JSON Schema for the (nested) variables file,
+// for editors and CI checks. It matches what NestedProjectSecrets.Read accepts.
+func VariablesFileSchema() map[string]any {
+	secret := map[string]any{
+		"type":                 "object",
+		"additionalProperties": false,
+		"properties": map[string]any{
+			"key": map[string]any{
+				"type":        "string",
+				"description": "Variable name; omitted on nested entries, which inherit it.",
+				"pattern":     "^[a-zA-Z0-9_]+$",
+				"maxLength":   MAX_KEY_LENGTH,
+			},
+			"value": map[string]any{
+				"type":        "string",
+				"description": "Value, secret reference (op://, vault://, env://, file://), encrypted value (age://), or file path for file variables.",
+				"default":     "",
+			},
+			"description": map[string]any{
+				"type":      "string",
+				"maxLength": MAX_DESCRIPTION_LENGTH,
+				"default":   "",
+			},
+			"type": map[string]any{
+				"type":    "string",
+				"enum":    []string{"env_var", "file"},
+				"default": "env_var",
+			},
+			"env": map[string]any{
+				"type":        "string",
+				"description": "Environment scope; * matches all environments.",
+				"maxLength":   MAX_ENVIRONMENT_LENGTH,
+				"default":     "*",
+			},
+			"protect": map[string]any{"type": "boolean", "default": false},
+			"mask":    map[string]any{"type": "boolean", "default": false},
+			"raw":     map[string]any{"type": "boolean", "default": false},
+			"nested": map[string]any{
+				"type":        "array",
+				"description": "Definitions of the same key that differ in some fields; fields set on the parent apply to all of them.",
+				"items":       map[string]any{"$ref": "#/$defs/secret"},
+			},
+		},
+	}
+	return map[string]any{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"title":                "credder variables file",
+		"type":                 "object",
+		"additionalProperties": false,
+		"required":             []string{"variables"},
+		"properties": map[string]any{
+			"project_id": map[string]any{
+				"type":        "integer",
+				"description": "Project that owns the variables; set only one of project_id, group_id and instance.",
+			},
+			"group_id": map[string]any{
+				"type":        "string",
+				"description": "Group (ID or full path) that owns the variables.",
+			},
+			"instance": map[string]any{
+				"type":        "boolean",
+				"description": "Instance-level variables; these have no environment scope.",
+			},
+			"gitlab_url": map[string]any{
+				"type":        "string",
+				"description": "Base URL of the GitLab instance.",
+				"format":      "uri",
+			},
+			"age_recipients": map[string]any{
+				"type":        "array",
+				"description": "age public keys that credder encrypt encrypts values for.",
+				"items":       map[string]any{"type": "string", "pattern": "^age1"},
+			},
+			"variables": map[string]any{
+				"type":  "array",
+				"items": map[string]any{"$ref": "#/$defs/secret"},
+			},
+		},
+		"$defs": map[string]any{
+			"secret": secret,
+		},
+	}
+}
+
+func Schema() error {
+	content, err := json.MarshalIndent(VariablesFileSchema(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding JSON: %w", err)
+	}
+	fmt.Println(string(content))
+	return nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ScopeMatches reports whether an environment scope applies to an
+// environment. As in GitLab, * matches any characters, including /, and
+// matching is case-sensitive. Jobs without an environment only get *
+// variables.
+func ScopeMatches(scope string, environment string) bool {
+	if scope == "*" {
+		return true
+	}
+	if environment == "" {
+		return false
+	}
+	if scope == environment {
+		return true
+	}
+	if !strings.Contains(scope, "*") {
+		return false
+	}
+	parts := strings.Split(scope, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$").MatchString(environment)
+}
+
+// scopeRank orders matching scopes like GitLab does: the exact environment
+// name wins over a wildcard pattern, which wins over *. GitLab does not
+// define which of two matching wildcard patterns wins.
+func scopeRank(scope string, environment string) int {
+	switch {
+	case scope == environment:
+		return 2
+	case scope == "*":
+		return 0
+	}
+	return 1
+}
+
+// ScopeResolution is the outcome of resolving one key for an environment.
+type ScopeResolution struct {
+	Key    string
+	Winner Secret
+	// Ambiguous holds matching definitions with the same precedence as the
+	// winner; GitLab may use any of them.
+	Ambiguous []Secret
+	// Shadowed holds matching definitions that lose to the winner.
+	Shadowed []Secret
+}
+
+// Resolve determines, per key, which variable GitLab uses in the given
+// environment, in key order. On ties the first definition in the file wins.
+func (project ProjectSecrets) Resolve(environment string) []ScopeResolution {
+	matching := make(map[string][]Secret)
+	keys := []string{}
+	for _, secret := range project.Variables {
+		if !ScopeMatches(secret.Environment, environment) {
+			continue
+		}
+		if _, found := matching[secret.Key]; !found {
+			keys = append(keys, secret.Key)
+		}
+		matching[secret.Key] = append(matching[secret.Key], secret)
+	}
+
+	resolutions := []ScopeResolution{}
+	for _, key := range keys {
+		candidates := matching[key]
+		winner := candidates[0]
+		for _, secret := range candidates[1:] {
+			if scopeRank(secret.Environment, environment) > scopeRank(winner.Environment, environment) {
+				winner = secret
+			}
+		}
+		resolution := ScopeResolution{Key: key, Winner: winner}
+		rank := scopeRank(winner.Environment, environment)
+		for _, secret := range candidates {
+			switch {
+			case secret.VariableKey() == winner.VariableKey():
+			case scopeRank(secret.Environment, environment) == rank:
+				resolution.Ambiguous = append(resolution.Ambiguous, secret)
+			default:
+				resolution.Shadowed = append(resolution.Shadowed, secret)
+			}
+		}
+		resolutions = append(resolutions, resolution)
+	}
+	return resolutions
+}
+
+// ForEnvironment returns, per key, the variable GitLab uses in the given
+// environment, in key order.
+func (project ProjectSecrets) ForEnvironment(environment string) []Secret {
+	variables := []Secret{}
+	for _, resolution := range project.Resolve(environment) {
+		variables = append(variables, resolution.Winner)
+	}
+	return variables
+}
+
+// scopesOverlap reports whether some environment matches both scopes.
+func scopesOverlap(a string, b string) bool {
+	// overlap[i][j]: a[i:] and b[j:] match a common name.
+	overlap := make([][]bool, len(a)+1)
+	for i := range overlap {
+		overlap[i] = make([]bool, len(b)+1)
+	}
+	for i := len(a); i >= 0; i-- {
+		for j := len(b); j >= 0; j-- {
+			switch {
+			case i == len(a) && j == len(b):
+				overlap[i][j] = true
+			case i < len(a) && a[i] == '*':
+				overlap[i][j] = overlap[i+1][j] || (j < len(b) && overlap[i][j+1])
+			case j < len(b) && b[j] == '*':
+				overlap[i][j] = overlap[i][j+1] || (i < len(a) && overlap[i+1][j])
+			case i < len(a) && j < len(b) && a[i] == b[j]:
+				overlap[i][j] = overlap[i+1][j+1]
+			}
+		}
+	}
+	return overlap[0][0]
+}
+
+// ScopeWarnings finds definitions whose outcome GitLab leaves open: wildcard
+// scopes of one key that match a common environment.
+func (project ProjectSecrets) ScopeWarnings() []ValidationProblem {
+	warnings := []ValidationProblem{}
+	for i, secret := range project.Variables {
+		for _, other := range project.Variables[:i] {
+			if other.Key != secret.Key || other.Environment == secret.Environment {
+				continue
+			}
+			warn := func(format string, args ...any) {
+				warnings = append(warnings, ValidationProblem{
+					Key:         secret.Key,
+					Environment: secret.Environment,
+					Message:     fmt.Sprintf(format, args...),
+				})
+			}
+			switch {
+			case other.Environment == "*" || secret.Environment == "*":
+			case !strings.Contains(other.Environment, "*") || !strings.Contains(secret.Environment, "*"):
+			case scopesOverlap(other.Environment, secret.Environment):
+				warn("ambiguous with scope %s; both match some environments and GitLab may use either", other.Environment)
+			}
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScopeMatches(t *testing.T) {
+	tests := []struct {
+		scope       string
+		environment string
+		want        bool
+	}{
+		{"*", "production", true},
+		{"*", "", true},
+		{"production", "production", true},
+		{"Production", "production", false},
+		{"Review/*", "review/app-1", false},
+		{"production", "staging", false},
+		{"review/*", "review/app-1", true},
+		{"review/*", "review/team/app-1", true},
+		{"review/*", "review", false},
+		{"*/app-1", "review/app-1", true},
+		{"review/*", "", false},
+		{"a.b*", "axb", false},
+	}
+	for _, test := range tests {
+		if got := ScopeMatches(test.scope, test.environment); got != test.want {
+			t.Errorf(`ScopeMatches(%q, %q) = %v, want %v`, test.scope, test.environment, got, test.want)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	project := ProjectSecrets{Variables: []Secret{
+		{Key: "A", Environment: "*"},
+		{Key: "A", Environment: "review/*"},
+		{Key: "A", Environment: "review/app-1"},
+		{Key: "B", Environment: "review/*"},
+		{Key: "B", Environment: "*/app-1"},
+		{Key: "C", Environment: "production"},
+	}}
+
+	resolutions := project.Resolve("review/app-1")
+	if len(resolutions) != 2 {
+		t.Fatalf(`Resolve() = %v, want A and B`, resolutions)
+	}
+	a, b := resolutions[0], resolutions[1]
+	if a.Winner.Environment != "review/app-1" || len(a.Shadowed) != 2 || len(a.Ambiguous) != 0 {
+		t.Errorf(`Resolve() for A = %+v, want review/app-1 overriding two scopes`, a)
+	}
+	if b.Winner.Environment != "review/*" || len(b.Ambiguous) != 1 || b.Ambiguous[0].Environment != "*/app-1" {
+		t.Errorf(`Resolve() for B = %+v, want review/* ambiguous with */app-1`, b)
+	}
+
+	scopes := []string{}
+	for _, secret := range project.ForEnvironment("review/app-2") {
+		scopes = append(scopes, secret.Key+" "+secret.Environment)
+	}
+	want := []string{"A review/*", "B review/*"}
+	if !reflect.DeepEqual(scopes, want) {
+		t.Errorf(`ForEnvironment("review/app-2") = %v, want %v`, scopes, want)
+	}
+	if got := project.ForEnvironment(""); len(got) != 1 || got[0].Environment != "*" {
+		t.Errorf(`ForEnvironment("") = %v, want only A *`, got)
+	}
+}
+
+func TestScopeWarnings(t *testing.T) {
+	project := ProjectSecrets{Variables: []Secret{
+		{Key: "A", Environment: "*"},
+		{Key: "A", Environment: "review/*"},
+		{Key: "A", Environment: "*/app-1"},
+		{Key: "A", Environment: "staging/*"},
+		{Key: "B", Environment: "production"},
+		{Key: "B", Environment: "Production"},
+		{Key: "C", Environment: "review/*"},
+		{Key: "C", Environment: "Review/*"},
+	}}
+	messages := []string{}
+	for _, warning := range project.ScopeWarnings() {
+		messages = append(messages, warning.String())
+	}
+	want := []string{
+		"A (*/app-1): ambiguous with scope review/*; both match some environments and GitLab may use either",
+		"A (staging/*): ambiguous with scope */app-1; both match some environments and GitLab may use either",
+	}
+	if !reflect.DeepEqual(messages, want) {
+		t.Errorf(`ScopeWarnings() = %q, want %q`, messages, want)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TriggeredPipeline is a downstream pipeline started by a trigger job.
+type TriggeredPipeline struct {
+	Job string
+	// Project and Branch are set for a multi-project pipeline; an empty
+	// branch means the default branch.
+	Project string
+	Branch  string
+	// Include holds the include entries of a child pipeline's configuration.
+	Include []any
+	// Generated names the job whose artifact holds a child configuration,
+	// which cannot be linted ahead of the pipeline.
+	Generated string
+	// Variables are passed down: the global variables the job inherits and
+	// those of the trigger job.
+	Variables []string
+}
+
+// inheritedVariables returns the global variables a job inherits, following
+// inherit:variables, which is true, false or a list of names.
+func inheritedVariables(job *yaml.Node, global []string) []string {
+	inherit := mappingValue(job.Content, "inherit")
+	if inherit == nil || inherit.Kind != yaml.MappingNode {
+		return append([]string{}, global...)
+	}
+	variables := mappingValue(inherit.Content, "variables")
+	switch {
+	case variables == nil:
+		return append([]string{}, global...)
+	case variables.Kind == yaml.ScalarNode && variables.Value == "false":
+		return []string{}
+	case variables.Kind == yaml.SequenceNode:
+		listed := make(map[string]bool)
+		for _, name := range variables.Content {
+			listed[name.Value] = true
+		}
+		inherited := []string{}
+		for _, name := range global {
+			if listed[name] {
+				inherited = append(inherited, name)
+			}
+		}
+		return inherited
+	}
+	return append([]string{}, global...)
+}
+
+// TriggeredPipelines finds the trigger jobs of a merged configuration, after
+// extends and !reference are expanded.
+func TriggeredPipelines(content string) ([]TriggeredPipeline, error) {
+	expanded, err := expandConfigNode(content, "")
+	if err != nil {
+		return nil, err
+	}
+
+	global := []string{}
+	if variables := mappingValue(expanded.Content, "variables"); variables != nil {
+		for j := 0; j+1 < len(variables.Content); j += 2 {
+			global = append(global, variables.Content[j].Value)
+		}
+	}
+
+	pipelines := []TriggeredPipeline{}
+	for i := 0; i+1 < len(expanded.Content); i += 2 {
+		name, job := expanded.Content[i].Value, expanded.Content[i+1]
+		if ciKeywords[name] || job.Kind != yaml.MappingNode {
+			continue
+		}
+		node := mappingValue(job.Content, "trigger")
+		if node == nil {
+			continue
+		}
+		var trigger any
+		err := node.Decode(&trigger)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trigger in job %s: %w", name, err)
+		}
+
+		pipeline := TriggeredPipeline{Job: name, Variables: inheritedVariables(job, global)}
+		if variables := mappingValue(job.Content, "variables"); variables != nil {
+			for j := 0; j+1 < len(variables.Content); j += 2 {
+				pipeline.Variables = append(pipeline.Variables, variables.Content[j].Value)
+			}
+		}
+		if project, ok := trigger.(string); ok {
+			pipeline.Project = project
+			pipelines = append(pipelines, pipeline)
+			continue
+		}
+		detailed, ok := yamlMap(trigger)
+		if !ok {
+			return nil, fmt.Errorf("invalid trigger in job %s: not a project or a hash", name)
+		}
+		if project, ok := detailed["project"].(string); ok {
+			pipeline.Project = project
+			pipeline.Branch, _ = detailed["branch"].(string)
+			pipelines = append(pipelines, pipeline)
+			continue
+		}
+
+		include := detailed["include"]
+		if include == nil {
+			return nil, fmt.Errorf("invalid trigger in job %s: no project or include", name)
+		}
+		if entries, ok := include.([]any); ok {
+			pipeline.Include = entries
+		} else {
+			pipeline.Include = []any{include}
+		}
+		for _, item := range pipeline.Include {
+			if entry, ok := yamlMap(item); ok && entry["artifact"] != nil {
+				pipeline.Generated = fmt.Sprint(entry["job"])
+			}
+		}
+		pipelines = append(pipelines, pipeline)
+	}
+	return pipelines, nil
+}
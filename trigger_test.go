@@ -0,0 +1,97 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTriggeredPipelines(t *testing.T) {
+	config := `
+variables:
+  REGION: eu
+  TIER: staging
+.downstream:
+  trigger:
+    include: ci/child.yml
+child:
+  extends: .downstream
+  variables:
+    TARGET: review
+children:
+  trigger:
+    include:
+      - local: ci/a.yml
+      - project: group/templates
+        file: child.yml
+generated:
+  trigger:
+    include:
+      - artifact: generated.yml
+        job: generate
+deploy:
+  trigger: group/deployments
+  inherit:
+    variables: false
+release:
+  trigger:
+    project: group/releases
+    branch: stable
+  inherit:
+    variables: [REGION]
+build:
+  script: [make]
+`
+	pipelines, err := TriggeredPipelines(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TriggeredPipeline{
+		{Job: "child", Include: []any{"ci/child.yml"}, Variables: []string{"REGION", "TIER", "TARGET"}},
+		{Job: "children", Include: []any{
+			map[string]any{"local": "ci/a.yml"},
+			map[string]any{"project": "group/templates", "file": "child.yml"},
+		}, Variables: []string{"REGION", "TIER"}},
+		{Job: "generated", Include: []any{
+			map[string]any{"artifact": "generated.yml", "job": "generate"},
+		}, Generated: "generate", Variables: []string{"REGION", "TIER"}},
+		{Job: "deploy", Project: "group/deployments", Variables: []string{}},
+		{Job: "release", Project: "group/releases", Branch: "stable", Variables: []string{"REGION"}},
+	}
+	if !reflect.DeepEqual(pipelines, want) {
+		t.Errorf("TriggeredPipelines() =\n%#v\nwant\n%#v", pipelines, want)
+	}
+}
+
+func TestTriggeredPipelinesReferenceToExtends(t *testing.T) {
+	config := `
+.base:
+  script: [make]
+build:
+  extends: .base
+test:
+  script:
+    - !reference [build, script]
+`
+	pipelines, err := TriggeredPipelines(config)
+	if err != nil || len(pipelines) != 0 {
+		t.Errorf("TriggeredPipelines() = %v, %v, want no pipelines", pipelines, err)
+	}
+}
+
+func TestTriggerTargetKeepsJobVariables(t *testing.T) {
+	variables := make([]string, 1, 4)
+	variables[0] = "JOB"
+	trigger := TriggeredPipeline{Job: "child", Include: []any{"child.yml"}, Variables: variables}
+
+	first, err := triggerTarget(lintTarget{Name: "main", Inherited: []string{"FIRST"}}, trigger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := triggerTarget(lintTarget{Name: "main", Inherited: []string{"SECOND"}}, trigger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(first.Inherited, []string{"JOB", "FIRST"}) || !reflect.DeepEqual(second.Inherited, []string{"JOB", "SECOND"}) {
+		t.Fatalf(`triggerTarget() inherited %v and %v, want [JOB FIRST] and [JOB SECOND]`, first.Inherited, second.Inherited)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits and formats GitLab enforces on CI/CD variables.
+const (
+	MAX_KEY_LENGTH         = 255
+	MAX_VALUE_LENGTH       = 10000
+	MAX_DESCRIPTION_LENGTH = 255
+	MAX_ENVIRONMENT_LENGTH = 255
+)
+
+var keyPattern = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// maskablePattern mirrors GitLab's rule for masked values: at least 8
+// characters of the Base64 alphabet plus @ : . ~ -, on a single line.
+var maskablePattern = regexp.MustCompile(`^[a-zA-Z0-9_+=/@:.~-]{8,}$`)
+
+// ValidationProblem is a variable GitLab would reject.
+type ValidationProblem struct {
+	Key         string
+	Environment string
+	Message     string
+}
+
+func (problem ValidationProblem) String() string {
+	return fmt.Sprintf("%s (%s): %s", problem.Key, problem.Environment, problem.Message)
+}
+
+// Validate checks all variables against GitLab's rules, so a push does not
+// fail halfway. Values must be injected, since masking depends on them.
+func (project ProjectSecrets) Validate() []ValidationProblem {
+	problems := []ValidationProblem{}
+	seen := make(map[VariableKey]bool)
+	for _, secret := range project.Variables {
+		report := func(format string, args ...any) {
+			problems = append(problems, ValidationProblem{
+				Key:         secret.Key,
+				Environment: secret.Environment,
+				Message:     fmt.Sprintf(format, args...),
+			})
+		}
+
+		if seen[secret.VariableKey()] {
+			report("defined more than once")
+		}
+		seen[secret.VariableKey()] = true
+
+		if utf8.RuneCountInString(secret.Key) > MAX_KEY_LENGTH {
+			report("key is longer than %d characters", MAX_KEY_LENGTH)
+		}
+		if !keyPattern.MatchString(secret.Key) {
+			report("key may only contain letters, digits and _")
+		}
+		if secret.VariableType != "env_var" && secret.VariableType != "file" {
+			report("type must be env_var or file, not %q", secret.VariableType)
+		}
+		if utf8.RuneCountInString(secret.Environment) > MAX_ENVIRONMENT_LENGTH {
+			report("environment scope is longer than %d characters", MAX_ENVIRONMENT_LENGTH)
+		}
+		if secret.Environment == "" {
+			report("environment scope is empty; use * for all environments")
+		}
+		if utf8.RuneCountInString(secret.Description) > MAX_DESCRIPTION_LENGTH {
+			report("description is longer than %d characters", MAX_DESCRIPTION_LENGTH)
+		}
+		if length := utf8.RuneCountInString(secret.Value); length > MAX_VALUE_LENGTH {
+			report("value is %d characters, more than the limit of %d", length, MAX_VALUE_LENGTH)
+		}
+		if secret.Mask && !maskablePattern.MatchString(secret.Value) {
+			switch {
+			case strings.Contains(secret.Value, "\n"):
+				report("value cannot be masked: it spans multiple lines")
+			case utf8.RuneCountInString(secret.Value) < 8:
+				report("value cannot be masked: it is shorter than 8 characters")
+			default:
+				report("value cannot be masked: only letters, digits and _ + = / @ : . ~ - are allowed")
+			}
+		}
+	}
+	return problems
+}
+
+// reportProblems writes validation problems to w and returns an error when
+// there are any.
+func reportProblems(w io.Writer, problems []ValidationProblem) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	for _, problem := range problems {
+		fmt.Fprintln(w, "=>", problem)
+	}
+	return fmt.Errorf("%d variable problem(s) found", len(problems))
+}
+
+// Validate checks the variables file without talking to GitLab.
+func Validate() error {
+	local := ProjectSecrets{}
+	err := local.Read(DEFAULT_FILE_NAME)
+	if err != nil {
+		return fmt.Errorf("could not load local variables file: %w", err)
+	}
+	local = local.InjectFiles().InjectSecrets()
+	err = reportProblems(os.Stdout, local.Validate())
+	if err != nil {
+		return err
+	}
+	fmt.Println("Valid :)")
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	valid := Secret{
+		Key:          "DEPLOY_TOKEN",
+		Value:        "glpat-abcdefgh1234",
+		VariableType: "env_var",
+		Environment:  "*",
+		Mask:         true,
+	}
+	project := ProjectSecrets{Variables: []Secret{valid}}
+	if problems := project.Validate(); len(problems) != 0 {
+		t.Fatalf(`Validate() = %v, want no problems`, problems)
+	}
+
+	tests := []struct {
+		change  func(secret *Secret)
+		message string
+	}{
+		{func(s *Secret) { s.Key = "DEPLOY-TOKEN" }, "key may only contain letters, digits and _"},
+		{func(s *Secret) { s.Value = "short" }, "value cannot be masked: it is shorter than 8 characters"},
+		{func(s *Secret) { s.Value = "line one\nline two" }, "value cannot be masked: it spans multiple lines"},
+		{func(s *Secret) { s.Value = "has spaces in it" }, "value cannot be masked: only letters, digits and _ + = / @ : . ~ - are allowed"},
+		{func(s *Secret) { s.VariableType = "secret" }, `type must be env_var or file, not "secret"`},
+		{func(s *Secret) { s.Mask, s.Value = false, strings.Repeat("a", MAX_VALUE_LENGTH+1) }, "value is 10001 characters, more than the limit of 10000"},
+		{func(s *Secret) { s.Description = strings.Repeat("é", MAX_DESCRIPTION_LENGTH+1) }, "description is longer than 255 characters"},
+	}
+	for _, test := range tests {
+		secret := valid
+		test.change(&secret)
+		project := ProjectSecrets{Variables: []Secret{secret}}
+		problems := project.Validate()
+		if len(problems) != 1 || problems[0].Message != test.message {
+			t.Fatalf(`Validate() = %v, want %q`, problems, test.message)
+		}
+	}
+
+	// Limits count characters, not bytes.
+	multibyte := valid
+	multibyte.Mask = false
+	multibyte.Value = strings.Repeat("é", MAX_VALUE_LENGTH)
+	multibyte.Description = strings.Repeat("é", MAX_DESCRIPTION_LENGTH)
+	multibyte.Environment = strings.Repeat("é", MAX_ENVIRONMENT_LENGTH)
+	project = ProjectSecrets{Variables: []Secret{multibyte}}
+	if problems := project.Validate(); len(problems) != 0 {
+		t.Fatalf(`Validate() = %v, want no problems for multi-byte values at the limit`, problems)
+	}
+
+	project = ProjectSecrets{Variables: []Secret{valid, valid}}
+	if problems := project.Validate(); len(problems) != 1 || problems[0].Message != "defined more than once" {
+		t.Fatalf(`Validate() = %v, want a duplicate`, problems)
+	}
+}